@@ -2,5 +2,5 @@ package main
 
 import "embed"
 
-//go:embed content
-var ContentFS embed.FS
\ No newline at end of file
+//go:embed content themes
+var ContentFS embed.FS
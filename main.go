@@ -1,18 +1,199 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/ryanrolds/pedantic_orderliness/site"
 	"github.com/sirupsen/logrus"
 )
 
+const usage = `Usage: pedantic_orderliness <command> [flags]
+
+Commands:
+  serve              Serve the site over HTTP (default)
+  build              Export every route to a directory
+  new post <slug>    Write a front matter skeleton to the posts directory
+  validate           Load all content and report problems
+
+Run "pedantic_orderliness <command> -h" for the flags of a command.
+`
+
+const embeddedContent = "embedded"
+const defaultTheme = "default"
+const themeUsage = "embedded theme name, or a theme directory or bundle, templates and assets in the content override it"
+const contentUsage = "comma separated content directories, zip or tar bundles, and \"embedded\", earlier ones override later ones"
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
 func main() {
-	env := os.Getenv("ENV")
-	if env == "" {
-		env = "local"
+	command := "serve"
+	args := os.Args[1:]
+
+	// Flags without a command, e.g. "-port 8081", are passed to serve
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+
+	var err error
+	switch command {
+	case "serve":
+		err = runServe(args)
+	case "build":
+		err = runBuild(args)
+	case "new":
+		err = runNew(args)
+	case "validate":
+		err = runValidate(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	port := flags.String("port", getEnv("PORT", "8081"), "port to listen on")
+	env := flags.String("env", getEnv("ENV", "local"), "environment (local, test, production)")
+	content := flags.String("content", "", contentUsage)
+	theme := flags.String("theme", defaultTheme, themeUsage)
+	dev := flags.Bool("dev", false, "reload content and theme from disk as they change, implies -content content")
+	adminToken := flags.String("admin-token", os.Getenv("ADMIN_TOKEN"), "bearer token for POST /_admin/reload, disabled when empty")
+	flags.Parse(args)
+
+	if *dev && *content == "" {
+		*content = "content"
+	}
+
+	// Embedded themes are read from their directory so template and style edits are seen too
+	if *dev && isThemeName(*theme) {
+		*theme = filepath.Join("themes", *theme)
+	}
+
+	site, err := newSite(*port, *env, *content, *theme)
+	if err != nil {
+		return err
+	}
+
+	site.SetDev(*dev)
+	site.SetAdminToken(*adminToken)
+
+	return site.Run()
+}
+
+func runBuild(args []string) error {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	env := flags.String("env", getEnv("ENV", "production"), "environment (local, test, production)")
+	content := flags.String("content", "", contentUsage)
+	theme := flags.String("theme", defaultTheme, themeUsage)
+	out := flags.String("out", "public", "directory to write the site to")
+	flags.Parse(args)
+
+	// Also accept the directory as an argument, e.g. "build public"
+	if flags.NArg() > 0 {
+		*out = flags.Arg(0)
+	}
+
+	site, err := newSite("", *env, *content, *theme)
+	if err != nil {
+		return err
+	}
+
+	return site.Build(*out)
+}
+
+func runValidate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	env := flags.String("env", getEnv("ENV", "production"), "environment (local, test, production)")
+	content := flags.String("content", "", contentUsage)
+	theme := flags.String("theme", defaultTheme, themeUsage)
+	flags.Parse(args)
+
+	site, err := newSite("", *env, *content, *theme)
+	if err != nil {
+		return err
+	}
+
+	return site.Validate()
+}
+
+func runNew(args []string) error {
+	flags := flag.NewFlagSet("new", flag.ExitOnError)
+	content := flags.String("content", "content", "content directory to write to")
+	title := flags.String("title", "", "title of the post, defaults to the slug")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: pedantic_orderliness new post [flags] <slug>")
+		flags.PrintDefaults()
+	}
+
+	if len(args) == 0 || args[0] != "post" {
+		flags.Usage()
+		return fmt.Errorf("unknown content type, only posts can be created")
+	}
+
+	// The slug may come before or after the flags
+	slug := ""
+	rest := args[1:]
+	if len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		slug = rest[0]
+		rest = rest[1:]
 	}
 
+	flags.Parse(rest)
+	if slug == "" && flags.NArg() == 1 {
+		slug = flags.Arg(0)
+	} else if slug == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("expected a single slug")
+	}
+
+	if !slugPattern.MatchString(slug) {
+		return fmt.Errorf("slug %q should only contain lower case letters, digits, underscores, and dashes", slug)
+	}
+
+	if *title == "" {
+		*title = strings.ReplaceAll(slug, "_", " ")
+	}
+
+	skeleton := fmt.Sprintf("---\ntitle: %q\npublished: %s\nintro: \"\"\ncategory: \"\"\ntags: []\n---\n",
+		*title, time.Now().UTC().Format(time.RFC3339))
+
+	filename := filepath.Join(*content, site.PostsDir, slug+".md")
+
+	// Never clobber an existing post
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteString(skeleton)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(filename)
+
+	return nil
+}
+
+func newSite(port string, env string, contentSources string, themeSource string) (*site.Site, error) {
 	log := setupLog(env)
 
 	hostname, err := os.Hostname()
@@ -26,19 +207,81 @@ func main() {
 		"host": hostname,
 	})
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8081"
+	content, err := getContentFS(contentSources)
+	if err != nil {
+		return nil, err
 	}
 
-	site := site.NewSite(port, env, log)
-	site.SetContentFS(ContentFS)
-	err = site.Run()
+	theme, err := getThemeFS(themeSource)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	os.Exit(0)
+	site := site.NewSite(port, env, log)
+	site.SetContentFS(content)
+	site.SetThemeFS(theme)
+
+	return site, nil
+}
+
+// getContentFS opens a comma separated list of content sources, earlier sources override later ones. Sources
+// are directories, .zip/.tar/.tar.gz bundles, or "embedded" for the content built in to the binary.
+func getContentFS(sources string) (fs.FS, error) {
+	if sources == "" {
+		sources = embeddedContent
+	}
+
+	layers := []fs.FS{}
+	for _, source := range strings.Split(sources, ",") {
+		var layer fs.FS
+		var err error
+
+		if source == embeddedContent {
+			layer, err = fs.Sub(ContentFS, "content")
+		} else {
+			layer, err = site.OpenContent(source)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		layers = append(layers, layer)
+	}
+
+	if len(layers) == 1 {
+		return layers[0], nil
+	}
+
+	return site.NewOverlayFS(layers...), nil
+}
+
+// getThemeFS opens an embedded theme by name, or a theme directory or bundle
+func getThemeFS(source string) (fs.FS, error) {
+	if source == "" {
+		return nil, nil
+	}
+
+	if isThemeName(source) {
+		if _, err := fs.Stat(ContentFS, "themes/"+source); err == nil {
+			return fs.Sub(ContentFS, "themes/"+source)
+		}
+	}
+
+	return site.OpenContent(source)
+}
+
+// isThemeName is true for bare names, they are embedded themes, anything that looks like a path is opened from disk
+func isThemeName(source string) bool {
+	return source != "" && !strings.ContainsAny(source, "/.")
+}
+
+func getEnv(key string, fallback string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	return value
 }
 
 func setupLog(env string) *logrus.Entry {
@@ -0,0 +1,105 @@
+package site
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"time"
+)
+
+const archiveKey = "archive"
+
+// ArchiveData lists the periods posts were published in, newest first
+type ArchiveData struct {
+	Periods []*ArchivePeriod
+}
+
+// ArchivePeriod is a year, or a month within a year, and the number of posts published in it
+type ArchivePeriod struct {
+	Title   string
+	Path    string
+	Count   int
+	Periods []*ArchivePeriod
+	posts   []*Post
+}
+
+// buildArchives renders /archive, a page per year, and a page per month that had posts
+func (p *PageManager) buildArchives() error {
+	years := []*ArchivePeriod{}
+	var year, month *ArchivePeriod
+
+	// Posts are ordered newest first, so are the periods
+	for _, post := range p.posts.GetAll() {
+		publishedAt := post.PublishedAt.UTC()
+
+		yearPath := path.Join("/", archiveKey, fmt.Sprint(publishedAt.Year()))
+		if year == nil || year.Path != yearPath {
+			year = &ArchivePeriod{
+				Title: fmt.Sprint(publishedAt.Year()),
+				Path:  yearPath,
+			}
+			years = append(years, year)
+			month = nil
+		}
+
+		monthPath := path.Join(yearPath, fmt.Sprintf("%02d", publishedAt.Month()))
+		if month == nil || month.Path != monthPath {
+			month = &ArchivePeriod{
+				Title: fmt.Sprintf("%s %d", publishedAt.Month(), publishedAt.Year()),
+				Path:  monthPath,
+			}
+			year.Periods = append(year.Periods, month)
+		}
+
+		year.Count++
+		year.posts = append(year.posts, post)
+		month.Count++
+		month.posts = append(month.posts, post)
+	}
+
+	err := p.buildArchive(archiveKey, "Archive", years, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, year := range years {
+		err := p.buildArchive(year.Path[1:], year.Title, year.Periods, year.posts)
+		if err != nil {
+			return err
+		}
+
+		for _, month := range year.Periods {
+			err := p.buildArchive(month.Path[1:], month.Title, nil, month.posts)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (p *PageManager) buildArchive(key string, title string, periods []*ArchivePeriod, posts []*Post) error {
+	buf := &bytes.Buffer{}
+	err := p.templates.ExecuteTemplate(buf, "archive.tmpl", &TemplateData{
+		Key:        key,
+		Title:      title,
+		Posts:      &posts,
+		Social:     &Social{},
+		Site:       p.site,
+		Hashes:     p.hashes,
+		Generated:  time.Now(),
+		Config:     p.config,
+		SiteAuthor: p.authors.GetDefault(),
+		Archive: &ArchiveData{
+			Periods: periods,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	p.setListing(key, buf.Bytes())
+
+	return nil
+}
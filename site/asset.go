@@ -1,5 +1,9 @@
 package site
 
+import (
+	"io/fs"
+)
+
 //log "github.com/sirupsen/logrus"
 
 type Asset struct {
@@ -9,19 +13,21 @@ type Asset struct {
 }
 
 type AssetManager struct {
-	dir   string
-	cache *Cache
+	content fs.FS
+	dir     string
+	cache   *Cache
 }
 
-func NewAssetManager(dir string) *AssetManager {
+func NewAssetManager(content fs.FS, dir string) *AssetManager {
 	return &AssetManager{
-		dir:   dir,
-		cache: NewCache(),
+		content: content,
+		dir:     dir,
+		cache:   NewCache(),
 	}
 }
 
 func (p *AssetManager) Load() error {
-	keys, err := getKeys("content/static", "")
+	keys, err := getKeys(p.content, AssetsDir, "")
 	if err != nil {
 		return err
 	}
@@ -47,8 +53,12 @@ func (p *AssetManager) Get(key string) *Asset {
 	return item.(*Asset)
 }
 
+func (p *AssetManager) GetKeys() []string {
+	return p.cache.GetKeys()
+}
+
 func (p *AssetManager) buildAsset(filename string) (*Asset, error) {
-	buffer, mime, err := getAsset(filename)
+	buffer, mime, err := getAsset(p.content, filename)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,112 @@
+package site
+
+import (
+	"html/template"
+	"io/fs"
+	"sort"
+
+	"github.com/pkg/errors"
+	bf "github.com/russross/blackfriday/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// AuthorsFile holds the profiles of everyone that writes for the site, keyed by id
+const AuthorsFile = "authors.yaml"
+const authorsDir = "authors"
+
+type Author struct {
+	Id    string `yaml:"-"`
+	Name  string `yaml:"name"`
+	Photo string `yaml:"photo"`
+	Url   string `yaml:"url"`
+	Path  string `yaml:"-"`
+
+	// The bio is Markdown
+	BioMarkdown string        `yaml:"bio"`
+	Bio         template.HTML `yaml:"-"`
+}
+
+// Authors are the profiles from the authors file, posts that don't list their authors are by the default author
+type Authors struct {
+	authors   map[string]*Author
+	defaultId string
+}
+
+// LoadAuthors reads the authors file, the default author is the id of a profile or just a name
+func LoadAuthors(content fs.FS, defaultId string) (*Authors, error) {
+	authors := &Authors{
+		authors:   map[string]*Author{},
+		defaultId: defaultId,
+	}
+
+	data, err := fs.ReadFile(content, AuthorsFile)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, errors.Wrapf(err, "problem reading %s", AuthorsFile)
+	}
+
+	if err == nil {
+		err = yaml.UnmarshalStrict(data, &authors.authors)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem parsing %s", AuthorsFile)
+		}
+	}
+
+	// A default author that isn't in the file is a name, e.g. "Ryan Olds"
+	if _, ok := authors.authors[defaultId]; !ok && defaultId != "" {
+		authors.defaultId = slugify(defaultId)
+		authors.authors[authors.defaultId] = &Author{Name: defaultId}
+	}
+
+	for id, author := range authors.authors {
+		if author == nil || author.Name == "" {
+			return nil, errors.Errorf("author %s in %s has no name", id, AuthorsFile)
+		}
+
+		author.Id = id
+		author.Path = "/" + authorsDir + "/" + id
+		author.Bio = template.HTML(bf.Run([]byte(author.BioMarkdown)))
+	}
+
+	return authors, nil
+}
+
+func (a *Authors) Get(id string) *Author {
+	return a.authors[id]
+}
+
+// GetDefault returns the site's author, nil if the site doesn't have one
+func (a *Authors) GetDefault() *Author {
+	return a.authors[a.defaultId]
+}
+
+// GetByIds looks up the authors of a post, no ids is the default author
+func (a *Authors) GetByIds(ids []string) ([]*Author, error) {
+	authors := []*Author{}
+	for _, id := range ids {
+		author := a.Get(id)
+		if author == nil {
+			return nil, errors.Errorf("author %s not in %s", id, AuthorsFile)
+		}
+
+		authors = append(authors, author)
+	}
+
+	if len(authors) == 0 && a.GetDefault() != nil {
+		authors = append(authors, a.GetDefault())
+	}
+
+	return authors, nil
+}
+
+func (a *Authors) GetAll() []*Author {
+	authors := []*Author{}
+	for _, author := range a.authors {
+		authors = append(authors, author)
+	}
+
+	sort.Slice(authors, func(i, j int) bool {
+		return authors[i].Id < authors[j].Id
+	})
+
+	return authors
+}
@@ -0,0 +1,113 @@
+package site
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// bundleIndex is the markdown of a post that is a directory, the other files in the directory are served with it
+const bundleIndex = "index.md"
+const bundleStyles = "index.css"
+const bundleScript = "index.js"
+
+// getPostKeys finds the posts, each is either posts/slug.md or a bundle at posts/slug/index.md
+func getPostKeys(content fs.FS) ([]string, error) {
+	files, err := fs.ReadDir(content, PostsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, file := range files {
+		switch {
+		case file.IsDir() && isPostBundle(content, file.Name()):
+			keys = append(keys, file.Name())
+		case !file.IsDir() && path.Ext(file.Name()) == ".md":
+			keys = append(keys, strings.TrimSuffix(file.Name(), ".md"))
+		}
+	}
+
+	return keys, nil
+}
+
+func isPostBundle(content fs.FS, key string) bool {
+	_, err := fs.Stat(content, path.Join(PostsDir, key, bundleIndex))
+	return err == nil
+}
+
+// getBundleFiles reads the files bundled with a post, keyed by their path in the bundle
+func getBundleFiles(content fs.FS, key string) (map[string]*Asset, error) {
+	dir := path.Join(PostsDir, key)
+
+	files := map[string]*Asset{}
+	err := fs.WalkDir(content, dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		// The markdown and its styles and script are part of the post
+		filename := strings.TrimPrefix(name, dir+"/")
+		if filename == bundleIndex || filename == bundleStyles || filename == bundleScript {
+			return nil
+		}
+
+		buffer, err := fs.ReadFile(content, name)
+		if err != nil {
+			return errors.Wrapf(err, "problem reading file %s", name)
+		}
+
+		// Files without a known extension are sniffed
+		mimeType := mime.TypeByExtension(path.Ext(filename))
+		if mimeType == "" {
+			mimeType = http.DetectContentType(buffer)
+		}
+
+		files[filename] = &Asset{
+			Mime:    mimeType,
+			Content: &buffer,
+			Etag:    getEtag(&buffer),
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// getBundlePath resolves a reference relative to a bundle's directory, references that aren't relative are
+// returned as is
+func getBundlePath(ref string, base *url.URL) string {
+	parsed, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" || parsed.Path == "" ||
+		strings.HasPrefix(parsed.Path, "/") {
+		return ref
+	}
+
+	return base.ResolveReference(parsed).String()
+}
+
+// getBundleBase returns the path the files of a post's bundle are served under
+func getBundleBase(key string) *url.URL {
+	return &url.URL{Path: "/" + path.Join(PostsDir, key) + "/"}
+}
+
+// resolveBundleLinks points the relative links and sources in a bundled post's body at the bundle, the post is
+// served without a trailing slash so browsers would otherwise resolve them against /posts
+func resolveBundleLinks(body []byte, base *url.URL) ([]byte, error) {
+	return rewriteFragment(body, func(ref string) string {
+		return getBundlePath(ref, base)
+	}, nil)
+}
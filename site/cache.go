@@ -1,12 +1,16 @@
 package site
 
 import (
+	"sync"
+
 	log "github.com/sirupsen/logrus"
 )
 
 type ContentCache map[string]interface{}
 
+// Cache is safe for concurrent use, scheduled posts are published while requests are served
 type Cache struct {
+	mu    sync.RWMutex
 	cache ContentCache
 }
 
@@ -17,6 +21,9 @@ func NewCache() *Cache {
 }
 
 func (c *Cache) GetKeys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	var keys []string
 	for key := range c.cache {
 		keys = append(keys, key)
@@ -26,6 +33,9 @@ func (c *Cache) GetKeys() []string {
 }
 
 func (c *Cache) GetValues() []interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	var values []interface{}
 	for _, value := range c.cache {
 		values = append(values, value)
@@ -35,6 +45,9 @@ func (c *Cache) GetValues() []interface{} {
 }
 
 func (c *Cache) Get(key string) interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	item, exists := c.cache[key]
 	if exists { // Found an item in the cache
 		log.Debug("cache hit")
@@ -47,5 +60,15 @@ func (c *Cache) Get(key string) interface{} {
 }
 
 func (c *Cache) Set(key string, item interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	c.cache[key] = item
 }
+
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.cache, key)
+}
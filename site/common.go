@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io/fs"
 	"mime"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -15,8 +17,10 @@ import (
 	"golang.org/x/net/html"
 )
 
-func getKeys(dir string, suffix string) ([]string, error) {
-	files, err := fs.ReadDir(ContentFS, dir)
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+func getKeys(content fs.FS, dir string, suffix string) ([]string, error) {
+	files, err := fs.ReadDir(content, dir)
 	if err != nil {
 		return nil, err
 	}
@@ -32,9 +36,9 @@ func getKeys(dir string, suffix string) ([]string, error) {
 	return keys, nil
 }
 
-func getAsset(filename string) (*[]byte, string, error) {
+func getAsset(content fs.FS, filename string) (*[]byte, string, error) {
 	// Get file contents
-	contents, err := fs.ReadFile(ContentFS, "content/static/"+filename)
+	contents, err := fs.ReadFile(content, path.Join(AssetsDir, filename))
 	if err != nil {
 		return nil, "", err
 	}
@@ -45,9 +49,9 @@ func getAsset(filename string) (*[]byte, string, error) {
 	return &contents, mimeType, nil
 }
 
-func getCSS(key string) (*[]byte, error) {
+func getCSS(content fs.FS, key string) (*[]byte, error) {
 	// Get file contents
-	css, err := fs.ReadFile(ContentFS, key+".css")
+	css, err := fs.ReadFile(content, key+".css")
 	if err != nil {
 		if _, ok := err.(*fs.PathError); ok {
 			return &[]byte{}, nil
@@ -59,9 +63,9 @@ func getCSS(key string) (*[]byte, error) {
 	return &css, nil
 }
 
-func getJavaScript(key string) (*[]byte, error) {
+func getJavaScript(content fs.FS, key string) (*[]byte, error) {
 	// Get file contents
-	javaScript, err := fs.ReadFile(ContentFS, key+".js")
+	javaScript, err := fs.ReadFile(content, key+".js")
 	if err != nil {
 		if _, ok := err.(*fs.PathError); ok {
 			return &[]byte{}, nil
@@ -73,10 +77,10 @@ func getJavaScript(key string) (*[]byte, error) {
 	return &javaScript, nil
 }
 
-func getMarkdown(key string, log *logrus.Entry) (*[]byte, error) {
+func getMarkdown(content fs.FS, key string, log *logrus.Entry) (*[]byte, error) {
 	// Get file contents
 	log.Info("Loading file ", key+".md")
-	content, err := fs.ReadFile(ContentFS, key+".md")
+	markdown, err := fs.ReadFile(content, key+".md")
 	if err != nil {
 		if _, ok := err.(*fs.PathError); ok {
 			return nil, nil
@@ -85,7 +89,7 @@ func getMarkdown(key string, log *logrus.Entry) (*[]byte, error) {
 		return nil, err
 	}
 
-	return &content, nil
+	return &markdown, nil
 }
 
 func getEtag(buffer *[]byte) string {
@@ -129,7 +133,7 @@ func getTitle(doc *html.Node, log *logrus.Entry) string {
 		log.Warn("Title not found for post")
 	}
 
-	return html.EscapeString(title)
+	return title
 }
 
 func getIntro(doc *html.Node, log *logrus.Entry) string {
@@ -188,3 +192,66 @@ func getDateFromFrontMatter(details map[string]interface{}, key string) (time.Ti
 
 	return value, nil
 }
+
+func getIntFromFrontMatter(details map[string]interface{}, key string) (int, error) {
+	valueRaw, ok := details[key]
+	if !ok {
+		return 0, errors.Errorf("detail %s not found", key)
+	}
+
+	value, ok := valueRaw.(int)
+	if !ok {
+		return 0, errors.Errorf("detail %s not an integer", key)
+	}
+
+	return value, nil
+}
+
+func getBoolFromFrontMatter(details map[string]interface{}, key string) (bool, error) {
+	valueRaw, ok := details[key]
+	if !ok {
+		return false, errors.Errorf("detail %s not found", key)
+	}
+
+	value, ok := valueRaw.(bool)
+	if !ok {
+		return false, errors.Errorf("detail %s not true or false", key)
+	}
+
+	return value, nil
+}
+
+// getStringsFromFrontMatter accepts a list or a single string, a missing detail is an empty list
+func getStringsFromFrontMatter(details map[string]interface{}, key string) ([]string, error) {
+	valueRaw, ok := details[key]
+	if !ok || valueRaw == nil {
+		return []string{}, nil
+	}
+
+	if value, ok := valueRaw.(string); ok {
+		return []string{value}, nil
+	}
+
+	valueList, ok := valueRaw.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("detail %s not a list", key)
+	}
+
+	values := []string{}
+	for _, item := range valueList {
+		value, ok := item.(string)
+		if !ok {
+			return nil, errors.Errorf("detail %s contains a non-string value", key)
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// slugify lower cases the value and collapses anything that is not a letter or digit in to dashes
+func slugify(value string) string {
+	slug := nonSlugChars.ReplaceAllString(strings.ToLower(value), "-")
+	return strings.Trim(slug, "-")
+}
@@ -0,0 +1,46 @@
+package site
+
+import (
+	"io/fs"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFile is the optional site configuration at the root of the content
+const ConfigFile = "site.yaml"
+
+// Config describes the site to feeds and templates, anything not in the config file keeps its default
+type Config struct {
+	Title       string `yaml:"title"`
+	Description string `yaml:"description"`
+	Author      string `yaml:"author"`
+	FullContent bool   `yaml:"full_content"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Title:       "Pedantic Orderliness",
+		Description: "An assortment of technical posts, projects, game reviews, and random musings by Ryan Olds.",
+		Author:      "Ryan Olds",
+	}
+}
+
+func LoadConfig(content fs.FS) (*Config, error) {
+	config := NewConfig()
+
+	data, err := fs.ReadFile(content, ConfigFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading %s", ConfigFile)
+	}
+
+	err = yaml.UnmarshalStrict(data, config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem parsing %s", ConfigFile)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,279 @@
+package site
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const watchInterval = 500 * time.Millisecond
+const reloadPath = "/_dev/reload"
+
+// fileStamp is used to detect changes to a file between scans
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watcher polls the content and theme and reloads the parts of the site affected by changes
+type Watcher struct {
+	site     *Site
+	interval time.Duration
+	files    map[string]fileStamp
+	stop     chan struct{}
+}
+
+func NewWatcher(site *Site, interval time.Duration) *Watcher {
+	return &Watcher{
+		site:     site,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+func (w *Watcher) Start() error {
+	files, err := w.scan()
+	if err != nil {
+		return err
+	}
+
+	w.files = files
+	go w.run()
+
+	return nil
+}
+
+func (w *Watcher) Stop() {
+	close(w.stop)
+}
+
+func (w *Watcher) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.check()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *Watcher) check() {
+	files, err := w.scan()
+	if err != nil {
+		w.site.Log.WithError(err).Warn("Problem scanning content")
+		return
+	}
+
+	changed := []string{}
+	for name, stamp := range files {
+		previous, ok := w.files[name]
+		if !ok || previous != stamp {
+			changed = append(changed, name)
+		}
+	}
+
+	for name := range w.files {
+		if _, ok := files[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+
+	w.files = files
+
+	if len(changed) == 0 {
+		return
+	}
+
+	sort.Strings(changed)
+	w.site.Log.Infof("Content changed: %s", strings.Join(changed, ", "))
+
+	err = w.site.reload(changed)
+	if err != nil {
+		// Keep serving what we have, the next save will try again
+		w.site.Log.WithError(err).Error("Problem reloading content")
+		return
+	}
+
+	w.site.reloads.Broadcast()
+}
+
+func (w *Watcher) scan() (map[string]fileStamp, error) {
+	files := map[string]fileStamp{}
+
+	err := fs.WalkDir(w.site.getThemedFS(), ContentDir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		files[name] = fileStamp{
+			modTime: info.ModTime(),
+			size:    info.Size(),
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// reload rebuilds the caches affected by the changed files
+func (s *Site) reload(changed []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.getSnapshot()
+
+	posts := []string{}
+	pages := []string{}
+	for _, name := range changed {
+		dir, file := path.Split(name)
+		dir = path.Clean(dir)
+		ext := path.Ext(file)
+		key := strings.TrimSuffix(file, ext)
+
+		switch {
+		case ext == ".tmpl" || dir == AssetsDir || name == ConfigFile || name == AuthorsFile ||
+			name == RedirectsFile:
+			// Templates, asset hashes, and the data files are used by every rendered page or the router
+			return s.Reload()
+		case dir == PostsDir && (ext == ".md" || ext == ".css" || ext == ".js"):
+			posts = append(posts, key)
+		case strings.HasPrefix(dir, PostsDir+"/"):
+			// Anything in a bundle rebuilds its post
+			bundle := strings.TrimPrefix(dir, PostsDir+"/")
+			posts = append(posts, strings.SplitN(bundle, "/", 2)[0])
+		case (ext == ".md" || ext == ".css" || ext == ".js") && !strings.HasPrefix(name, PostsDir+"/") &&
+			!strings.HasPrefix(name, AssetsDir+"/"):
+			// Pages in directories are keyed by their path
+			pages = append(pages, strings.TrimSuffix(name, ext))
+		}
+	}
+
+	for _, key := range posts {
+		if err := snapshot.posts.Reload(key); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range pages {
+		if err := snapshot.pages.Reload(key); err != nil {
+			return err
+		}
+	}
+
+	if len(posts) == 0 {
+		return nil
+	}
+
+	// Publish dates may have changed
+	if s.scheduler != nil {
+		s.scheduler.Wake()
+	}
+
+	// Listings and feeds include post titles and intros and every page lists the recent posts
+	return snapshot.pages.Load()
+}
+
+// devHandler serves reload events and keeps requests out of the current snapshot while it's patched
+func (s *Site) devHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == reloadPath {
+			s.reloadHandler(w, r)
+			return
+		}
+
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reloadHandler streams a Server-Sent Event to the page each time the content is reloaded
+func (s *Site) reloadHandler(w http.ResponseWriter, r *http.Request) {
+	// The stream outlives the server's write timeout
+	controller := http.NewResponseController(w)
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		s.Log.WithError(err).Warn("Unable to clear write deadline for reload stream")
+	}
+
+	reloads := s.reloads.Subscribe()
+	defer s.reloads.Unsubscribe(reloads)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	for {
+		select {
+		case <-reloads:
+			fmt.Fprint(w, "event: reload\ndata: {}\n\n")
+			controller.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// ReloadBroker fans reload events out to every open page
+type ReloadBroker struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]struct{}
+}
+
+func NewReloadBroker() *ReloadBroker {
+	return &ReloadBroker{
+		clients: map[chan struct{}]struct{}{},
+	}
+}
+
+func (b *ReloadBroker) Subscribe() chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	client := make(chan struct{}, 1)
+	b.clients[client] = struct{}{}
+
+	return client
+}
+
+func (b *ReloadBroker) Unsubscribe(client chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.clients, client)
+}
+
+func (b *ReloadBroker) Broadcast() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for client := range b.clients {
+		// A reload is already pending for slow clients
+		select {
+		case client <- struct{}{}:
+		default:
+		}
+	}
+}
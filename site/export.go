@@ -0,0 +1,154 @@
+package site
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// exportRoute maps a URL served by the router to the file it's written to
+type exportRoute struct {
+	url  string
+	file string
+}
+
+// exportResponse captures what a handler would have sent to the client
+type exportResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newExportResponse() *exportResponse {
+	return &exportResponse{
+		header: http.Header{},
+		status: http.StatusOK,
+	}
+}
+
+func (e *exportResponse) Header() http.Header {
+	return e.header
+}
+
+func (e *exportResponse) Write(buf []byte) (int, error) {
+	return e.body.Write(buf)
+}
+
+func (e *exportResponse) WriteHeader(status int) {
+	e.status = status
+}
+
+// Build loads the site and writes every route to dir as path based files
+func (s *Site) Build(dir string) error {
+	err := s.Load()
+	if err != nil {
+		return err
+	}
+
+	routes := s.getExportRoutes()
+	for _, route := range routes {
+		err := s.exportRoute(dir, route)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.Log.Infof("Exported %d files to %s", len(routes), dir)
+
+	return nil
+}
+
+// getExportRoutes lists every route the managers can serve, along with the file each should be written to
+func (s *Site) getExportRoutes() []exportRoute {
+	snapshot := s.getSnapshot()
+	routes := []exportRoute{
+		{url: "/", file: "index.html"},
+		{url: "/favicon.ico", file: "favicon.ico"},
+		{url: "/robots.txt", file: "robots.txt"},
+	}
+
+	for _, key := range snapshot.pages.GetKeys() {
+		switch {
+		case key == indexKey:
+			continue
+		case isErrorPage(key):
+			// Static hosts look for error pages next to the index
+			routes = append(routes, exportRoute{url: "/" + key, file: key + ".html"})
+		case path.Ext(key) != "":
+			routes = append(routes, exportRoute{url: "/" + key, file: key})
+		default:
+			routes = append(routes, exportRoute{url: "/" + key, file: path.Join(key, "index.html")})
+		}
+	}
+
+	// Later pages of listings are written where their page paths will look for them
+	for key, count := range snapshot.pages.GetPageCounts() {
+		listPath := "/" + key
+		if key == indexKey {
+			listPath = "/"
+		}
+
+		for pageNum := 2; pageNum <= count; pageNum++ {
+			url := GetPageURL(listPath, pageNum)
+			routes = append(routes, exportRoute{
+				url:  url,
+				file: path.Join(strings.TrimPrefix(url, "/"), "index.html"),
+			})
+		}
+	}
+
+	for _, key := range snapshot.posts.GetKeys() {
+		routes = append(routes, exportRoute{url: "/posts/" + key, file: path.Join("posts", key, "index.html")})
+
+		for _, name := range snapshot.posts.Get(key).GetFileNames() {
+			routes = append(routes, exportRoute{url: "/posts/" + key + "/" + name, file: path.Join("posts", key, name)})
+		}
+	}
+
+	for _, key := range snapshot.assets.GetKeys() {
+		routes = append(routes, exportRoute{url: "/static/" + key, file: path.Join("static", key)})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].file < routes[j].file
+	})
+
+	return routes
+}
+
+func (s *Site) exportRoute(dir string, route exportRoute) error {
+	request, err := http.NewRequest(http.MethodGet, route.url, nil)
+	if err != nil {
+		return errors.Wrapf(err, "problem creating request for %s", route.url)
+	}
+
+	response := newExportResponse()
+	s.router.ServeHTTP(response, request)
+
+	if response.status != http.StatusOK {
+		return errors.Errorf("unexpected status %d exporting %s", response.status, route.url)
+	}
+
+	filename := filepath.Join(dir, filepath.FromSlash(route.file))
+	if !strings.HasPrefix(filename, filepath.Clean(dir)) {
+		return errors.Errorf("export of %s escapes %s", route.url, dir)
+	}
+
+	err = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return errors.Wrapf(err, "problem creating directory for %s", filename)
+	}
+
+	err = os.WriteFile(filename, response.body.Bytes(), 0644)
+	if err != nil {
+		return errors.Wrapf(err, "problem writing %s", filename)
+	}
+
+	return nil
+}
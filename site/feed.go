@@ -0,0 +1,305 @@
+package site
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const rssMime = "application/rss+xml; charset=utf-8"
+const atomMime = "application/atom+xml; charset=utf-8"
+const atomNamespace = "http://www.w3.org/2005/Atom"
+const rssContentNamespace = "http://purl.org/rss/1.0/modules/content/"
+const dublinCoreNamespace = "http://purl.org/dc/elements/1.1/"
+
+// RssFeed is an RSS 2.0 document, https://www.rssboard.org/rss-specification
+type RssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	ContentNS string     `xml:"xmlns:content,attr"`
+	DCNS      string     `xml:"xmlns:dc,attr"`
+	Channel   RssChannel `xml:"channel"`
+}
+
+type RssChannel struct {
+	Title       string    `xml:"title"`
+	Description string    `xml:"description"`
+	Link        string    `xml:"link"`
+	AtomLink    AtomLink  `xml:"atom:link"`
+	PubDate     string    `xml:"pubDate"`
+	Ttl         int       `xml:"ttl"`
+	Image       RssImage  `xml:"image"`
+	Items       []RssItem `xml:"item"`
+}
+
+type RssImage struct {
+	Url   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type RssItem struct {
+	Title       string   `xml:"title"`
+	Description string   `xml:"description"`
+	Link        string   `xml:"link"`
+	Guid        string   `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Creators    []string `xml:"dc:creator"`
+	Content     string   `xml:"content:encoded,omitempty"`
+}
+
+// AtomFeed is an Atom 1.0 document, https://www.rfc-editor.org/rfc/rfc4287
+type AtomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	NS       string      `xml:"xmlns,attr"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Id       string      `xml:"id"`
+	Links    []AtomLink  `xml:"link"`
+	Updated  string      `xml:"updated"`
+	Author   AtomPerson  `xml:"author"`
+	Icon     string      `xml:"icon"`
+	Logo     string      `xml:"logo"`
+	Entries  []AtomEntry `xml:"entry"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type AtomPerson struct {
+	Name string `xml:"name"`
+	Uri  string `xml:"uri,omitempty"`
+}
+
+type AtomEntry struct {
+	Title     string       `xml:"title"`
+	Id        string       `xml:"id"`
+	Link      AtomLink     `xml:"link"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Authors   []AtomPerson `xml:"author"`
+	Summary   string       `xml:"summary"`
+	Content   *AtomContent `xml:"content,omitempty"`
+}
+
+type AtomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func (p *PageManager) buildRss() error {
+	// Get a list of most recent posts
+	return p.buildRssFeed(rssKey, "", p.posts.GetAll())
+}
+
+func (p *PageManager) buildAtom() error {
+	return p.buildAtomFeed(atomKey, "", p.posts.GetAll())
+}
+
+func (p *PageManager) buildRssFeed(key string, title string, posts []*Post) error {
+	siteUrl := getSiteUrl(p.site.Env)
+	title = p.getFeedTitle(title)
+
+	feed := &RssFeed{
+		Version:   "2.0",
+		AtomNS:    atomNamespace,
+		ContentNS: rssContentNamespace,
+		DCNS:      dublinCoreNamespace,
+		Channel: RssChannel{
+			Title:       title,
+			Description: p.config.Description,
+			Link:        siteUrl + "/",
+			AtomLink:    AtomLink{Href: siteUrl + "/" + key, Rel: "self", Type: "application/rss+xml"},
+			PubDate:     time.Now().UTC().Format(time.RFC1123Z),
+			Ttl:         1440,
+			Image: RssImage{
+				Url:   siteUrl + "/static/logo.png",
+				Title: title,
+				Link:  siteUrl + "/",
+			},
+		},
+	}
+
+	for _, post := range getFeedPosts(posts) {
+		item := RssItem{
+			Title:       post.Title,
+			Description: post.Intro,
+			Link:        post.Url,
+			Guid:        post.Url,
+			PubDate:     post.PublishedAt.UTC().Format(time.RFC1123Z),
+		}
+
+		for _, author := range post.Authors {
+			item.Creators = append(item.Creators, author.Name)
+		}
+
+		if p.config.FullContent {
+			item.Content = post.FeedContent
+		}
+
+		feed.Channel.Items = append(feed.Channel.Items, item)
+	}
+
+	// Tag and author feeds are removed along with their listings
+	p.listingKeys = append(p.listingKeys, key)
+
+	return p.setFeed(key, rssMime, feed)
+}
+
+func (p *PageManager) buildAtomFeed(key string, title string, posts []*Post) error {
+	siteUrl := getSiteUrl(p.site.Env)
+	posts = getFeedPosts(posts)
+
+	// Atom feeds are updated when their most recently changed post was
+	updatedAt := time.Time{}
+	for _, post := range posts {
+		if post.GetUpdatedAt().After(updatedAt) {
+			updatedAt = post.GetUpdatedAt()
+		}
+	}
+
+	feed := &AtomFeed{
+		NS:       atomNamespace,
+		Title:    p.getFeedTitle(title),
+		Subtitle: p.config.Description,
+		Id:       siteUrl + "/",
+		Links: []AtomLink{
+			{Href: siteUrl + "/"},
+			{Href: siteUrl + "/" + key, Rel: "self", Type: "application/atom+xml"},
+		},
+		Updated: updatedAt.UTC().Format(time.RFC3339),
+		Author:  p.getAtomPerson(siteUrl, p.authors.GetDefault()),
+		Icon:    siteUrl + "/favicon.ico",
+		Logo:    siteUrl + "/static/logo.png",
+	}
+
+	for _, post := range posts {
+		entry := AtomEntry{
+			Title:     post.Title,
+			Id:        getPostUrl(p.site.Env, post.Slug),
+			Link:      AtomLink{Href: post.Url, Rel: "alternate", Type: "text/html"},
+			Published: post.PublishedAt.UTC().Format(time.RFC3339),
+			Updated:   post.GetUpdatedAt().UTC().Format(time.RFC3339),
+			Summary:   post.Intro,
+		}
+
+		for _, author := range post.Authors {
+			entry.Authors = append(entry.Authors, p.getAtomPerson(siteUrl, author))
+		}
+
+		if p.config.FullContent {
+			entry.Content = &AtomContent{Type: "html", Body: post.FeedContent}
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	p.listingKeys = append(p.listingKeys, key)
+
+	return p.setFeed(key, atomMime, feed)
+}
+
+func (p *PageManager) getAtomPerson(siteUrl string, author *Author) AtomPerson {
+	if author == nil {
+		return AtomPerson{Name: p.config.Title}
+	}
+
+	return AtomPerson{Name: author.Name, Uri: siteUrl + author.Path}
+}
+
+// setFeed marshals a feed, or any other XML document, and caches it under key
+func (p *PageManager) setFeed(key string, mime string, feed interface{}) error {
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(buf)
+	encoder.Indent("", "    ")
+	if err := encoder.Encode(feed); err != nil {
+		return err
+	}
+
+	body := buf.Bytes()
+
+	p.cache.Set(key, &Page{
+		Content:      &body,
+		Etag:         getEtag(&body),
+		Mime:         mime,
+		CacheControl: "public, must-revalidate",
+	})
+
+	return nil
+}
+
+// getFeedTitle prefixes the title of feeds for a subset of posts with the site's title
+func (p *PageManager) getFeedTitle(title string) string {
+	if title == "" {
+		return p.config.Title
+	}
+
+	return p.config.Title + " :: " + title
+}
+
+// getFeedPosts limits feeds to the most recent posts
+func getFeedPosts(posts []*Post) []*Post {
+	if len(posts) > rssLimit {
+		return posts[:rssLimit]
+	}
+
+	return posts
+}
+
+// getFeedContent prepares a post's body for feed readers, links are made absolute as readers don't know where the
+// post came from and styles and scripts are removed as readers won't run them
+func getFeedContent(body []byte, postUrl string) (string, error) {
+	base, err := url.Parse(postUrl)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem parsing post url %s", postUrl)
+	}
+
+	content, err := rewriteFragment(body, func(ref string) string {
+		parsed, err := url.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			return ref
+		}
+
+		return base.ResolveReference(parsed).String()
+	}, isFeedStripped)
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// getAbsoluteUrl resolves a link from a post's front matter, e.g. its image, against the site for feed readers
+func getAbsoluteUrl(siteUrl string, ref string) string {
+	if ref == "" {
+		return ""
+	}
+
+	base, err := url.Parse(siteUrl + "/")
+	if err != nil {
+		return ref
+	}
+
+	parsed, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return ref
+	}
+
+	return base.ResolveReference(parsed).String()
+}
+
+func isFeedStripped(node *html.Node) bool {
+	return node.Type == html.ElementNode && (node.DataAtom == atom.Script || node.DataAtom == atom.Style)
+}
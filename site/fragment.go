@@ -0,0 +1,84 @@
+package site
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// refAttrs are the attributes that hold a single reference, srcset holds a list of them
+var refAttrs = map[string]bool{"href": true, "src": true, "poster": true}
+
+// rewriteFragment parses a fragment of a post's body, passes each reference in it through rewrite, and renders it
+// back, elements that strip returns true for are removed
+func rewriteFragment(body []byte, rewrite func(string) string, strip func(*html.Node) bool) ([]byte, error) {
+	context := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(bytes.NewReader(body), context)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem parsing post body")
+	}
+
+	buf := &bytes.Buffer{}
+	for _, node := range nodes {
+		if strip != nil && strip(node) {
+			continue
+		}
+
+		rewriteNode(node, rewrite, strip)
+
+		err := html.Render(buf, node)
+		if err != nil {
+			return nil, errors.Wrap(err, "problem rendering post body")
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func rewriteNode(node *html.Node, rewrite func(string) string, strip func(*html.Node) bool) {
+	if node.Type == html.ElementNode {
+		for idx, attr := range node.Attr {
+			switch {
+			case refAttrs[attr.Key]:
+				node.Attr[idx].Val = rewrite(attr.Val)
+			case attr.Key == "srcset":
+				node.Attr[idx].Val = rewriteSrcset(attr.Val, rewrite)
+			}
+		}
+	}
+
+	child := node.FirstChild
+	for child != nil {
+		next := child.NextSibling
+		if strip != nil && strip(child) {
+			node.RemoveChild(child)
+		} else {
+			rewriteNode(child, rewrite, strip)
+		}
+		child = next
+	}
+}
+
+// rewriteSrcset rewrites the url of each candidate in a srcset, e.g. "small.png 1x, large.png 2x". Data urls
+// contain commas so sets with them are left as is
+func rewriteSrcset(srcset string, rewrite func(string) string) string {
+	if strings.Contains(srcset, "data:") {
+		return srcset
+	}
+
+	candidates := strings.Split(srcset, ",")
+	for idx, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+
+		fields[0] = rewrite(fields[0])
+		candidates[idx] = strings.Join(fields, " ")
+	}
+
+	return strings.Join(candidates, ", ")
+}
@@ -0,0 +1,99 @@
+package site
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const jsonFeedKey = "feed.json"
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// JSONFeed is a JSON Feed 1.1 document, https://www.jsonfeed.org/version/1.1/
+type JSONFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageUrl string           `json:"home_page_url"`
+	FeedUrl     string           `json:"feed_url"`
+	Description string           `json:"description,omitempty"`
+	Icon        string           `json:"icon,omitempty"`
+	Favicon     string           `json:"favicon,omitempty"`
+	Language    string           `json:"language,omitempty"`
+	Authors     []JSONFeedAuthor `json:"authors,omitempty"`
+	Items       []JSONFeedItem   `json:"items"`
+}
+
+type JSONFeedAuthor struct {
+	Name string `json:"name"`
+	Url  string `json:"url,omitempty"`
+}
+
+type JSONFeedItem struct {
+	Id            string           `json:"id"`
+	Url           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHtml   string           `json:"content_html"`
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished time.Time        `json:"date_published"`
+	DateModified  time.Time        `json:"date_modified"`
+	Authors       []JSONFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+
+	// Extension with the post's word count, reading time in minutes, code blocks, and outline
+	Stats *Stats `json:"_stats,omitempty"`
+}
+
+func (p *PageManager) buildJSONFeed() error {
+	siteUrl := getSiteUrl(p.site.Env)
+
+	feed := &JSONFeed{
+		Version:     jsonFeedVersion,
+		Title:       p.config.Title,
+		HomePageUrl: siteUrl + "/",
+		FeedUrl:     siteUrl + "/" + jsonFeedKey,
+		Description: p.config.Description,
+		Icon:        siteUrl + "/static/logo.png",
+		Favicon:     siteUrl + "/favicon.ico",
+		Language:    "en",
+		Items:       []JSONFeedItem{},
+	}
+
+	if author := p.authors.GetDefault(); author != nil {
+		feed.Authors = []JSONFeedAuthor{{Name: author.Name, Url: siteUrl + author.Path}}
+	}
+
+	for _, post := range p.posts.GetRecent(rssLimit) {
+		authors := []JSONFeedAuthor{}
+		for _, author := range post.Authors {
+			authors = append(authors, JSONFeedAuthor{Name: author.Name, Url: siteUrl + author.Path})
+		}
+
+		feed.Items = append(feed.Items, JSONFeedItem{
+			Id:            post.Url,
+			Url:           post.Url,
+			Title:         post.Title,
+			ContentHtml:   post.FeedContent,
+			Summary:       post.Intro,
+			Image:         getAbsoluteUrl(siteUrl, post.Image),
+			DatePublished: post.PublishedAt.UTC(),
+			DateModified:  post.GetUpdatedAt().UTC(),
+			Authors:       authors,
+			Tags:          post.Tags,
+			Stats:         post.Stats,
+		})
+	}
+
+	body, err := json.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	p.cache.Set(jsonFeedKey, &Page{
+		Content:      &body,
+		Etag:         getEtag(&body),
+		Mime:         "application/feed+json; charset=utf-8",
+		CacheControl: "public, must-revalidate",
+	})
+
+	return nil
+}
@@ -2,12 +2,16 @@ package site
 
 import (
 	"bytes"
+	"fmt"
+	"html/template"
+	"io/fs"
 	"path"
 	"strings"
-	"text/template"
 	"time"
 
 	"github.com/antchfx/htmlquery"
+	"github.com/gernest/front"
+	"github.com/pkg/errors"
 	bf "github.com/russross/blackfriday/v2"
 )
 
@@ -15,6 +19,7 @@ const numRecent = 10
 const indexKey = "index"
 const rssLimit = 20
 const rssKey = "rss.xml"
+const atomKey = "atom.xml"
 const postsPerPage = 10
 
 type Page struct {
@@ -22,23 +27,53 @@ type Page struct {
 	Mime         string
 	Etag         string
 	CacheControl string
+	Link         string
+	NoIndex      bool
 }
 
 type PageManager struct {
 	dir       string
 	templates *template.Template
+	hashes    *Hashes
+	config    *Config
+	authors   *Authors
 	cache     *Cache
+	lists     *Cache
 	posts     *PostManager
 	site      *Site
+	matter    *front.Matter
+
+	// Keys of the rendered listings and feeds, they can disappear when posts are reloaded
+	listingKeys []string
+}
+
+// postList is a paginated listing of posts, e.g. the index or a tag
+type postList struct {
+	Key      string
+	Title    string
+	Path     string
+	Template string
+	Posts    []*Post
+	Pages    []*Page
+	Authors  []*Author
 }
 
-func NewPageManager(site *Site, dir string, templates *template.Template, posts *PostManager) *PageManager {
+func NewPageManager(site *Site, dir string, templates *template.Template, hashes *Hashes, config *Config,
+	authors *Authors, posts *PostManager) *PageManager {
+	m := front.NewMatter()
+	m.Handle("---", front.YAMLHandler)
+
 	return &PageManager{
 		dir:       dir,
 		templates: templates,
+		hashes:    hashes,
+		config:    config,
+		authors:   authors,
 		cache:     NewCache(),
+		lists:     NewCache(),
 		posts:     posts,
 		site:      site,
+		matter:    m,
 	}
 }
 
@@ -48,8 +83,41 @@ func (p *PageManager) Load() error {
 		return err
 	}
 
+	return p.BuildListings()
+}
+
+// BuildListings renders the pages that list posts, it's called again when posts change. Listings that are no
+// longer built, e.g. a tag that was removed from its only post, are removed once the rest have been rebuilt.
+func (p *PageManager) BuildListings() error {
+	previous := p.listingKeys
+	p.listingKeys = []string{}
+
+	err := p.buildListings()
+	if err != nil {
+		// Keep track of everything that may still be cached so the next build can clean up
+		p.listingKeys = append(p.listingKeys, previous...)
+		return err
+	}
+
+	current := map[string]bool{}
+	for _, key := range p.listingKeys {
+		current[key] = true
+	}
+
+	for _, key := range previous {
+		if !current[key] {
+			p.cache.Delete(key)
+			p.lists.Delete(key)
+		}
+	}
+
+	// The sitemap is built last, it must not list the removed listings
+	return p.buildSitemap()
+}
+
+func (p *PageManager) buildListings() error {
 	// Build index/home
-	err = p.buildIndex()
+	err := p.buildIndex()
 	if err != nil {
 		return err
 	}
@@ -60,7 +128,48 @@ func (p *PageManager) Load() error {
 		return err
 	}
 
-	return nil
+	// Build Atom
+	err = p.buildAtom()
+	if err != nil {
+		return err
+	}
+
+	// Build JSON Feed
+	err = p.buildJSONFeed()
+	if err != nil {
+		return err
+	}
+
+	// Build tag and category listings and their feeds
+	err = p.buildTaxonomy(p.posts.GetTags())
+	if err != nil {
+		return err
+	}
+
+	err = p.buildTaxonomy(p.posts.GetCategories())
+	if err != nil {
+		return err
+	}
+
+	// Build author profiles and their feeds
+	err = p.buildAuthors()
+	if err != nil {
+		return err
+	}
+
+	// Build year and month archives
+	err = p.buildArchives()
+	if err != nil {
+		return err
+	}
+
+	// Build series landing pages
+	return p.buildSeries()
+}
+
+// isErrorPage is true for the pages served with error statuses, they aren't linked to
+func isErrorPage(key string) bool {
+	return key == "404" || key == "410" || key == "500"
 }
 
 func (p *PageManager) Get(key string) *Page {
@@ -72,17 +181,51 @@ func (p *PageManager) Get(key string) *Page {
 	return item.(*Page)
 }
 
+// Reload rebuilds a single markdown page, removing it if the markdown is gone
+func (p *PageManager) Reload(key string) error {
+	err := p.buildPage(path.Join(PagesDir, key))
+	if err != nil {
+		return err
+	}
+
+	// The page may have been added or removed
+	return p.buildSitemap()
+}
+
+func (p *PageManager) GetKeys() []string {
+	return p.cache.GetKeys()
+}
+
+// GetPageCounts returns the number of pages in each paginated listing, keyed by listing
+func (p *PageManager) GetPageCounts() map[string]int {
+	counts := map[string]int{}
+	for _, item := range p.lists.GetValues() {
+		list := item.(*postList)
+		counts[list.Key] = len(list.Pages)
+	}
+
+	return counts
+}
+
+// GetPaginated returns a page of a listing, pages are rendered when the listing is built
 func (p *PageManager) GetPaginated(key string, pageNum int) *Page {
-	if key != "index" {
+	item := p.lists.Get(key)
+	if item == nil {
 		return p.Get(key)
 	}
-	
-	posts, totalPages, hasNext, hasPrev := p.posts.GetPaginated(pageNum, postsPerPage)
-	
-	if pageNum > totalPages && totalPages > 0 {
+
+	list := item.(*postList)
+	if pageNum < 1 || pageNum > len(list.Pages) {
 		return nil
 	}
-	
+
+	return list.Pages[pageNum-1]
+}
+
+// renderList runs a page of a post listing through the listing's template
+func (p *PageManager) renderList(list *postList, pageNum int, generated time.Time) (*Page, error) {
+	posts, totalPages, hasNext, hasPrev := paginatePosts(list.Posts, pageNum, postsPerPage)
+
 	nextPage := pageNum + 1
 	prevPage := pageNum - 1
 	if prevPage < 1 {
@@ -91,8 +234,9 @@ func (p *PageManager) GetPaginated(key string, pageNum int) *Page {
 	if nextPage > totalPages {
 		nextPage = totalPages
 	}
-	
+
 	paginationData := &PaginationData{
+		Path:        list.Path,
 		CurrentPage: pageNum,
 		TotalPages:  totalPages,
 		HasNext:     hasNext,
@@ -100,41 +244,67 @@ func (p *PageManager) GetPaginated(key string, pageNum int) *Page {
 		NextPage:    nextPage,
 		PrevPage:    prevPage,
 	}
-	
+
+	// The same links are sent as a Link header for clients that don't parse the page
+	links := []string{}
+	if hasPrev {
+		paginationData.PrevURL = GetPageURL(list.Path, prevPage)
+		links = append(links, fmt.Sprintf("<%s>; rel=\"prev\"", paginationData.PrevURL))
+	}
+	if hasNext {
+		paginationData.NextURL = GetPageURL(list.Path, nextPage)
+		links = append(links, fmt.Sprintf("<%s>; rel=\"next\"", paginationData.NextURL))
+	}
+
 	buf := &bytes.Buffer{}
-	err := p.templates.ExecuteTemplate(buf, "index.tmpl", &TemplateData{
-		Title:      "Home",
+	err := p.templates.ExecuteTemplate(buf, list.Template, &TemplateData{
+		Key:        list.Key,
+		Title:      list.Title,
 		CSS:        "",
 		JavaScript: "",
 		Content:    "",
 		Posts:      &posts,
 		Social:     &Social{},
 		Site:       p.site,
-		Generated:  time.Now(),
+		Hashes:     p.hashes,
+		Generated:  generated,
 		Pagination: paginationData,
+		Authors:    list.Authors,
+		Config:     p.config,
+		SiteAuthor: p.authors.GetDefault(),
 	})
 	if err != nil {
-		return nil
+		return nil, err
 	}
-	
+
 	body := buf.Bytes()
-	
+
 	return &Page{
 		Content:      &body,
 		Etag:         getEtag(&body),
 		Mime:         "text/html; charset=utf-8",
 		CacheControl: "public, must-revalidate",
+		Link:         strings.Join(links, ", "),
+	}, nil
+}
+
+// GetPageURL returns the canonical URL of a page of a listing, the first page is the listing itself
+func GetPageURL(listPath string, pageNum int) string {
+	if pageNum <= 1 {
+		return listPath
 	}
+
+	return path.Join(listPath, "page", fmt.Sprint(pageNum))
 }
 
 func (p *PageManager) buildMarkdownFiles() error {
-	keys, err := getKeys("content", ".md")
+	keys, err := getPageKeys(p.site.content)
 	if err != nil {
 		return err
 	}
 
 	for _, key := range keys {
-		err := p.buildPage("content/" + key)
+		err := p.buildPage(path.Join(PagesDir, key))
 		if err != nil {
 			return err
 		}
@@ -143,23 +313,81 @@ func (p *PageManager) buildMarkdownFiles() error {
 	return nil
 }
 
+// getPageKeys finds the markdown pages in the content and its directories, posts and assets have their own
+// managers
+func getPageKeys(content fs.FS) ([]string, error) {
+	keys := []string{}
+	err := fs.WalkDir(content, PagesDir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if name == PostsDir || name == AssetsDir || (name != PagesDir && strings.HasPrefix(entry.Name(), ".")) {
+				return fs.SkipDir
+			}
+
+			return nil
+		}
+
+		if path.Ext(name) == ".md" {
+			keys = append(keys, strings.TrimSuffix(name, ".md"))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// getPageKey maps a page's path to its key, pages in directories have hierarchical keys (projects/screeps) and
+// a directory's index page is served at the directory
+func getPageKey(pagePath string) string {
+	dir, file := path.Split(path.Clean(pagePath))
+	if dir != "" && file == indexKey {
+		return path.Clean(dir)
+	}
+
+	return path.Clean(pagePath)
+}
+
 func (p *PageManager) buildPage(pagePath string) error {
-	markdown, err := getMarkdown(pagePath, p.site.Log)
+	markdown, err := getMarkdown(p.site.content, pagePath, p.site.Log)
 	if err != nil {
 		return err
 	}
 
-	// Page does not exist
+	key := getPageKey(pagePath)
+	filename := pagePath + ".md"
+
+	// Page does not exist, or no longer exists
 	if markdown == nil {
+		p.cache.Delete(key)
 		return nil
 	}
 
-	css, err := getCSS(pagePath)
+	// Front matter is optional for pages
+	frontMatter := map[string]interface{}{}
+	if bytes.HasPrefix(*markdown, []byte("---")) {
+		var body string
+		frontMatter, body, err = p.matter.Parse(bytes.NewReader(*markdown))
+		if err != nil {
+			return errors.Wrapf(err, "problem parsing file %s", filename)
+		}
+
+		stripped := []byte(body)
+		markdown = &stripped
+	}
+
+	css, err := getCSS(p.site.content, pagePath)
 	if err != nil {
 		return err
 	}
 
-	javaScript, err := getJavaScript(pagePath)
+	javaScript, err := getJavaScript(p.site.content, pagePath)
 	if err != nil {
 		return err
 	}
@@ -173,21 +401,94 @@ func (p *PageManager) buildPage(pagePath string) error {
 		return err
 	}
 
-	// Get details from parsed html
+	// Pages without a title in their front matter use their first heading
+	social := &Social{}
+	title := ""
+	if _, ok := frontMatter["title"]; ok {
+		title, err = getStringFromFrontMatter(frontMatter, "title")
+		if err != nil {
+			return errors.Wrapf(err, "problem getting title from %s", filename)
+		}
+
+		social.Title = title
+	} else {
+		title = getTitle(doc, p.site.Log)
+	}
+
+	if _, ok := frontMatter["description"]; ok {
+		social.Description, err = getStringFromFrontMatter(frontMatter, "description")
+		if err != nil {
+			return errors.Wrapf(err, "problem getting description from %s", filename)
+		}
+	}
+
+	if _, ok := frontMatter["image"]; ok {
+		social.ImageUrl, err = getStringFromFrontMatter(frontMatter, "image")
+		if err != nil {
+			return errors.Wrapf(err, "problem getting image from %s", filename)
+		}
+	}
+
+	templateName := "page.tmpl"
+	if _, ok := frontMatter["template"]; ok {
+		templateName, err = getStringFromFrontMatter(frontMatter, "template")
+		if err != nil {
+			return errors.Wrapf(err, "problem getting template from %s", filename)
+		}
+
+		if p.templates.Lookup(templateName) == nil {
+			return errors.Errorf("template %s used by %s not found", templateName, filename)
+		}
+	}
+
+	noIndex := false
+	if _, ok := frontMatter["noindex"]; ok {
+		noIndex, err = getBoolFromFrontMatter(frontMatter, "noindex")
+		if err != nil {
+			return errors.Wrapf(err, "problem getting noindex from %s", filename)
+		}
+	}
+
+	styleNames, err := getStringsFromFrontMatter(frontMatter, "styles")
+	if err != nil {
+		return errors.Wrapf(err, "problem getting styles from %s", filename)
+	}
+
+	styles, err := getAssetURLs(styleNames, *p.hashes, nil, nil)
+	if err != nil {
+		return errors.Wrapf(err, "problem getting styles from %s", filename)
+	}
+
+	scriptNames, err := getStringsFromFrontMatter(frontMatter, "scripts")
+	if err != nil {
+		return errors.Wrapf(err, "problem getting scripts from %s", filename)
+	}
+
+	scripts, err := getAssetURLs(scriptNames, *p.hashes, nil, nil)
+	if err != nil {
+		return errors.Wrapf(err, "problem getting scripts from %s", filename)
+	}
+
 	posts := p.posts.GetRecent(numRecent)
-	title := getTitle(doc, p.site.Log)
 
 	// Run markdown through page template
 	buf := &bytes.Buffer{}
-	err = p.templates.ExecuteTemplate(buf, "page.tmpl", &TemplateData{
+	err = p.templates.ExecuteTemplate(buf, templateName, &TemplateData{
+		Key:        key,
 		Title:      title,
-		CSS:        string((*css)[:]),
-		JavaScript: string((*javaScript)[:]),
-		Content:    string(body[:]),
+		CSS:        template.CSS(*css),
+		JavaScript: template.JS(*javaScript),
+		Content:    template.HTML(body),
 		Posts:      &posts,
 		Site:       p.site,
-		Social:     &Social{},
+		Hashes:     p.hashes,
+		Social:     social,
 		Generated:  time.Now(),
+		Config:     p.config,
+		SiteAuthor: p.authors.GetDefault(),
+		NoIndex:    noIndex,
+		Styles:     styles,
+		Scripts:    scripts,
 	})
 	if err != nil {
 		return err
@@ -195,15 +496,12 @@ func (p *PageManager) buildPage(pagePath string) error {
 
 	content := buf.Bytes()
 
-	// Get the key from the page path
-	keyWithExt := path.Base(pagePath)
-	key := strings.TrimSuffix(keyWithExt, path.Ext(keyWithExt))
-
 	p.cache.Set(key, &Page{
 		Content:      &content,
 		Mime:         "text/html; charset=utf-8",
 		CacheControl: "public, must-revalidate",
 		Etag:         getEtag(&content),
+		NoIndex:      noIndex,
 	})
 
 	return nil
@@ -211,73 +509,128 @@ func (p *PageManager) buildPage(pagePath string) error {
 
 func (p *PageManager) buildIndex() error {
 	// Build index/home with pagination for page 1
-	posts, totalPages, hasNext, hasPrev := p.posts.GetPaginated(1, postsPerPage)
-	
-	paginationData := &PaginationData{
-		CurrentPage: 1,
-		TotalPages:  totalPages,
-		HasNext:     hasNext,
-		HasPrev:     hasPrev,
-		NextPage:    2,
-		PrevPage:    1,
+	return p.buildList(&postList{
+		Key:      indexKey,
+		Title:    "Home",
+		Path:     "/",
+		Template: "index.tmpl",
+		Posts:    p.posts.GetAll(),
+	})
+}
+
+// buildList renders every page of the listing up front so each has a stable Etag, the first page is also
+// cached under the listing's key
+func (p *PageManager) buildList(list *postList) error {
+	totalPages := (len(list.Posts) + postsPerPage - 1) / postsPerPage
+	if totalPages < 1 {
+		totalPages = 1
 	}
 
-	// Run markdown through page template
-	buf := &bytes.Buffer{}
-	err := p.templates.ExecuteTemplate(buf, "index.tmpl", &TemplateData{
-		Title:      "Home",
-		CSS:        "",
-		JavaScript: "",
-		Content:    "",
-		Posts:      &posts,
-		Social:     &Social{},
-		Site:       p.site,
-		Generated:  time.Now(),
-		Pagination: paginationData,
-	})
-	if err != nil {
-		return err
+	generated := time.Now()
+	pages := make([]*Page, 0, totalPages)
+	for pageNum := 1; pageNum <= totalPages; pageNum++ {
+		page, err := p.renderList(list, pageNum, generated)
+		if err != nil {
+			return errors.Wrapf(err, "problem rendering page %d of %s", pageNum, list.Key)
+		}
+
+		pages = append(pages, page)
 	}
 
-	body := buf.Bytes()
+	list.Pages = pages
+	p.lists.Set(list.Key, list)
+	p.cache.Set(list.Key, pages[0])
+	p.listingKeys = append(p.listingKeys, list.Key)
 
-	p.cache.Set(indexKey, &Page{
-		Content:      &body,
-		Etag:         getEtag(&body),
-		Mime:         "text/html; charset=utf-8",
-		CacheControl: "public, must-revalidate",
-	})
+	return nil
+}
+
+func (p *PageManager) buildTaxonomy(taxonomy *Taxonomy) error {
+	for _, term := range taxonomy.GetTerms() {
+		key := taxonomy.GetKey(term)
+		posts := taxonomy.GetPosts(term)
+
+		err := p.buildList(&postList{
+			Key:      key,
+			Title:    term,
+			Path:     "/" + key,
+			Template: "taxonomy.tmpl",
+			Posts:    posts,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = p.buildRssFeed(key+"/"+rssKey, term, posts)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (p *PageManager) buildRss() error {
-	// Get a list of most recent posts
-	posts := p.posts.GetRecent(rssLimit)
+func (p *PageManager) buildSeries() error {
+	for _, series := range p.posts.GetSeries() {
+		posts := series.Posts
+
+		buf := &bytes.Buffer{}
+		err := p.templates.ExecuteTemplate(buf, "series.tmpl", &TemplateData{
+			Key:        series.Key,
+			Title:      series.Title,
+			Posts:      &posts,
+			Social:     &Social{},
+			Site:       p.site,
+			Hashes:     p.hashes,
+			Generated:  time.Now(),
+			Config:     p.config,
+			SiteAuthor: p.authors.GetDefault(),
+		})
+		if err != nil {
+			return err
+		}
 
-	buf := &bytes.Buffer{}
-	err := p.templates.ExecuteTemplate(buf, "rss.tmpl", &TemplateData{
-		Title:      "",
-		CSS:        "",
-		JavaScript: "",
-		Content:    "",
-		Posts:      &posts,
-		Social:     &Social{},
-		Site:       p.site,
-		Generated:  time.Now(),
-	})
-	if err != nil {
-		return err
+		p.setListing(series.Key, buf.Bytes())
 	}
 
-	body := buf.Bytes()
+	return nil
+}
+
+func (p *PageManager) buildAuthors() error {
+	// Every profile gets a page, e.g. a guest author before their first post is published
+	byAuthor := p.posts.GetPostsByAuthor()
+	for _, author := range p.authors.GetAll() {
+		key := byAuthor.GetKey(author.Id)
+		posts := byAuthor.GetPosts(author.Id)
+
+		err := p.buildList(&postList{
+			Key:      key,
+			Title:    author.Name,
+			Path:     author.Path,
+			Template: "author.tmpl",
+			Posts:    posts,
+			Authors:  []*Author{author},
+		})
+		if err != nil {
+			return err
+		}
 
-	p.cache.Set(rssKey, &Page{
+		err = p.buildRssFeed(key+"/"+rssKey, author.Name, posts)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setListing caches a rendered archive or series page, it's removed if it isn't rebuilt with the listings
+func (p *PageManager) setListing(key string, body []byte) {
+	p.cache.Set(key, &Page{
 		Content:      &body,
 		Etag:         getEtag(&body),
-		Mime:         "application/rss+xml; charset=utf-8",
+		Mime:         "text/html; charset=utf-8",
 		CacheControl: "public, must-revalidate",
 	})
-
-	return nil
+	p.listingKeys = append(p.listingKeys, key)
 }
@@ -3,10 +3,12 @@ package site
 import (
 	"bytes"
 	"fmt"
+	"html/template"
 	"io/fs"
+	"path"
 	"sort"
 	"strings"
-	"text/template"
+	"sync"
 	"time"
 
 	"github.com/Depado/bfchroma"
@@ -18,61 +20,284 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-var ErrNotPublished = errors.New("Not published")
-
 type Post struct {
 	Slug        string
 	Title       string
 	Intro       string
 	Image       string
+	Body        *[]byte
+	FeedContent string
 	Content     *[]byte
 	PublishedAt time.Time
 	UpdatedAt   time.Time
+	UpdateNote  string
 	Etag        string
 	Url         string
+	Tags        []string
+	Category    string
+	Authors     []*Author
+	Series      string
+	SeriesOrder int
+	Aliases     []string
+	Gone        bool
+	Social      *Social
+	Styles      []string
+	Scripts     []string
+	Stats       *Stats
+
+	// Chroma's styles for the post's code blocks and the post's own styles and script
+	css        template.CSS
+	javaScript template.JS
+
+	// Images and files bundled with the post, keyed by their path in the bundle
+	files map[string]*Asset
+}
+
+// GetFile returns a file bundled with the post, nil if the post doesn't have it
+func (p *Post) GetFile(name string) *Asset {
+	return p.files[name]
+}
+
+// GetFileNames returns the paths of the files bundled with the post
+func (p *Post) GetFileNames() []string {
+	names := []string{}
+	for name := range p.files {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// GetUpdatedAt returns when the post last changed, posts that haven't been updated changed when published
+func (p *Post) GetUpdatedAt() time.Time {
+	if p.UpdatedAt.IsZero() {
+		return p.PublishedAt
+	}
+
+	return p.UpdatedAt
 }
 
 type PostManager struct {
-	dir         string
-	templates   *template.Template
-	cache       *Cache
+	dir       string
+	templates *template.Template
+	hashes    *Hashes
+	config    *Config
+	authors   *Authors
+	cache     *Cache
+	site      *Site
+	matter    *front.Matter
+
+	// Guards the indexes below, they are rebuilt when dev mode reloads a post
+	mu          sync.RWMutex
 	orderedList []*Post
-	site        *Site
-	matter      *front.Matter
+	tags        *Taxonomy
+	categories  *Taxonomy
+	byAuthor    *Taxonomy
+	series      map[string]*Series
+	aliases     map[string]string
+	scheduled   []*Post
+
+	// Retired posts answer with a 410 instead of a 404
+	gone map[string]bool
 }
 
-func NewPostManager(site *Site, dir string, templates *template.Template) *PostManager {
+func NewPostManager(site *Site, dir string, templates *template.Template, hashes *Hashes, config *Config,
+	authors *Authors) *PostManager {
 	m := front.NewMatter()
 	m.Handle("---", front.YAMLHandler)
 
 	return &PostManager{
-		dir:       dir,
-		templates: templates,
-		cache:     NewCache(),
-		site:      site,
-		matter:    m,
+		dir:        dir,
+		templates:  templates,
+		hashes:     hashes,
+		config:     config,
+		authors:    authors,
+		cache:      NewCache(),
+		site:       site,
+		matter:     m,
+		tags:       NewTaxonomy("tags"),
+		categories: NewTaxonomy("categories"),
+		byAuthor:   NewTaxonomy(authorsDir),
+		series:     map[string]*Series{},
+		aliases:    map[string]string{},
+		gone:       map[string]bool{},
 	}
 }
 
 func (p *PostManager) Load() error {
-	keys, err := getKeys("content/posts", ".md")
+	keys, err := getPostKeys(p.site.content)
 	if err != nil {
 		return err
 	}
 
+	posts := []*Post{}
+	gone := map[string]bool{}
+
 	for _, key := range keys {
 		post, err := p.buildPost(key)
 		if err != nil {
-			if err == ErrNotPublished {
-				continue
-			}
+			return err
+		}
+
+		if post.Gone {
+			gone[key] = true
+			continue
+		}
+
+		posts = append(posts, post)
+	}
+
+	return p.setPosts(posts, gone, time.Now())
+}
 
+// LoadPublished loads the posts of current, publishing the scheduled posts that are due by now, and returns the
+// posts that were published. The posts were built when current was loaded so the content isn't read again, they
+// are copied so current keeps serving while the copies are rendered.
+func (p *PostManager) LoadPublished(current *PostManager, now time.Time) ([]*Post, error) {
+	current.mu.RLock()
+	posts := []*Post{}
+	for _, post := range current.orderedList {
+		copied := *post
+		posts = append(posts, &copied)
+	}
+
+	due := map[string]bool{}
+	for _, post := range current.scheduled {
+		copied := *post
+		posts = append(posts, &copied)
+		due[post.Slug] = !now.Before(post.PublishedAt)
+	}
+
+	gone := map[string]bool{}
+	for key := range current.gone {
+		gone[key] = true
+	}
+	current.mu.RUnlock()
+
+	err := p.setPosts(posts, gone, now)
+	if err != nil {
+		return nil, err
+	}
+
+	published := []*Post{}
+	for _, post := range posts {
+		if due[post.Slug] {
+			published = append(published, post)
+		}
+	}
+
+	return published, nil
+}
+
+// setPosts files the built posts as published or scheduled, indexes them, and renders them
+func (p *PostManager) setPosts(posts []*Post, gone map[string]bool, now time.Time) error {
+	scheduled := []*Post{}
+	for _, post := range posts {
+		if p.isScheduled(post, now) {
+			log.Infof("Scheduling %s, not published until %s", post.Slug, post.PublishedAt)
+			scheduled = append(scheduled, post)
+			continue
+		}
+
+		p.cache.Set(post.Slug, post)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.scheduled = scheduled
+	p.gone = gone
+	p.index()
+
+	// Posts are rendered once every post is indexed, they link to the other parts of their series
+	for _, post := range p.orderedList {
+		err := p.renderPost(post)
+		if err != nil {
 			return err
 		}
+	}
+
+	// Scheduled posts are rendered too so template and series problems fail validation rather than the scheduler
+	for _, post := range p.scheduled {
+		err := p.renderPost(post)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reload rebuilds a single post and the indexes, removing the post if the markdown is gone
+func (p *PostManager) Reload(key string) error {
+	post, err := p.buildPost(key)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.cache.Delete(key)
+	delete(p.gone, key)
+
+	scheduled := []*Post{}
+	for _, item := range p.scheduled {
+		if item.Slug != key {
+			scheduled = append(scheduled, item)
+		}
+	}
 
+	if post != nil && post.Gone {
+		p.gone[key] = true
+	} else if post != nil && p.isScheduled(post, time.Now()) {
+		scheduled = append(scheduled, post)
+	} else if post != nil {
 		p.cache.Set(key, post)
 	}
 
+	p.scheduled = scheduled
+	p.index()
+
+	// The post may have joined, left, or been renamed in a series, the other parts link to it
+	for _, item := range p.orderedList {
+		if item.Slug != key && item.Series == "" {
+			continue
+		}
+
+		err := p.renderPost(item)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isScheduled is true for future posts, they are held back in production until the scheduler publishes them
+func (p *PostManager) isScheduled(post *Post, now time.Time) bool {
+	return now.Before(post.PublishedAt) && p.site.Env == "production"
+}
+
+// NextScheduled returns when the next scheduled post is due, false if nothing is scheduled
+func (p *PostManager) NextScheduled() (time.Time, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	next := time.Time{}
+	for _, post := range p.scheduled {
+		if next.IsZero() || post.PublishedAt.Before(next) {
+			next = post.PublishedAt
+		}
+	}
+
+	return next, !next.IsZero()
+}
+
+// index orders the published posts and files them by tag, category, author, and series, p.mu must be held
+func (p *PostManager) index() {
 	values := p.cache.GetValues()
 
 	posts := []*Post{}
@@ -80,13 +305,79 @@ func (p *PostManager) Load() error {
 		posts = append(posts, post.(*Post))
 	}
 
+	// Posts published at the same time are ordered by slug so listings render the same on every load
 	sort.Slice(posts, func(i, j int) bool {
+		if posts[i].PublishedAt.Equal(posts[j].PublishedAt) {
+			return posts[i].Slug < posts[j].Slug
+		}
+
 		return posts[i].PublishedAt.After(posts[j].PublishedAt)
 	})
 
+	// Index posts by tag, category, and author, newest first
+	tags := NewTaxonomy("tags")
+	categories := NewTaxonomy("categories")
+	byAuthor := NewTaxonomy(authorsDir)
+	for _, post := range posts {
+		for _, author := range post.Authors {
+			byAuthor.Add(author.Id, post)
+		}
+
+		for _, tag := range post.Tags {
+			tags.Add(tag, post)
+		}
+
+		if post.Category != "" {
+			categories.Add(post.Category, post)
+		}
+	}
+
 	p.orderedList = posts
+	p.tags = tags
+	p.categories = categories
+	p.byAuthor = byAuthor
+	p.series = getSeries(posts)
+	p.aliases = p.getAliases(posts)
+}
 
-	return nil
+// getAliases maps the old paths of posts to where they are now, aliases can't take over another post's path
+func (p *PostManager) getAliases(posts []*Post) map[string]string {
+	aliases := map[string]string{}
+	for _, post := range posts {
+		for _, alias := range post.Aliases {
+			// Aliases are old slugs or, if they start with a slash, any path
+			location := cleanRedirectPath(alias)
+			if !strings.HasPrefix(alias, "/") {
+				location = cleanRedirectPath(path.Join(PostsDir, alias))
+			}
+
+			if p.cache.Get(strings.TrimPrefix(location, "/"+PostsDir+"/")) != nil {
+				log.Warnf("Ignoring alias %s of %s, it's the path of a post", alias, post.Slug)
+				continue
+			}
+
+			aliases[location] = "/" + PostsDir + "/" + post.Slug
+		}
+	}
+
+	return aliases
+}
+
+// GetRedirect returns the post an old path now belongs to, or that the post at the path was retired
+func (p *PostManager) GetRedirect(location string) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if target, ok := p.aliases[location]; ok {
+		return target, false
+	}
+
+	key := strings.TrimPrefix(location, "/"+PostsDir+"/")
+	if key != location && p.gone[key] {
+		return "", true
+	}
+
+	return "", false
 }
 
 func (p *PostManager) Get(key string) *Post {
@@ -98,7 +389,14 @@ func (p *PostManager) Get(key string) *Post {
 	return item.(*Post)
 }
 
+func (p *PostManager) GetKeys() []string {
+	return p.cache.GetKeys()
+}
+
 func (p *PostManager) GetRecent(num int) []*Post {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
 	if num > len(p.orderedList) {
 		num = len(p.orderedList)
 	}
@@ -106,42 +404,108 @@ func (p *PostManager) GetRecent(num int) []*Post {
 	return p.orderedList[:num]
 }
 
+func (p *PostManager) GetAll() []*Post {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.orderedList
+}
+
+func (p *PostManager) GetTags() *Taxonomy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.tags
+}
+
+func (p *PostManager) GetCategories() *Taxonomy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.categories
+}
+
+// GetPostsByAuthor files posts under the ids of their authors
+func (p *PostManager) GetPostsByAuthor() *Taxonomy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.byAuthor
+}
+
+// GetSeries returns every series ordered by title
+func (p *PostManager) GetSeries() []*Series {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	series := []*Series{}
+	for _, item := range p.series {
+		series = append(series, item)
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].Title < series[j].Title
+	})
+
+	return series
+}
+
 func (p *PostManager) GetPaginated(page, pageSize int) ([]*Post, int, bool, bool) {
-	total := len(p.orderedList)
+	return paginatePosts(p.GetAll(), page, pageSize)
+}
+
+func (p *PostManager) GetTotalCount() int {
+	return len(p.GetAll())
+}
+
+func paginatePosts(list []*Post, page, pageSize int) ([]*Post, int, bool, bool) {
+	total := len(list)
 	totalPages := (total + pageSize - 1) / pageSize
-	
+
+	// An empty list still has a page, e.g. an author that hasn't published yet
+	if totalPages < 1 {
+		totalPages = 1
+	}
+
 	if page < 1 {
 		page = 1
 	}
 	if page > totalPages {
 		page = totalPages
 	}
-	
+
 	start := (page - 1) * pageSize
 	end := start + pageSize
-	
+
 	if start >= total {
 		return []*Post{}, totalPages, false, false
 	}
-	
+
 	if end > total {
 		end = total
 	}
-	
-	posts := p.orderedList[start:end]
+
+	posts := list[start:end]
 	hasNext := page < totalPages
 	hasPrev := page > 1
-	
-	return posts, totalPages, hasNext, hasPrev
-}
 
-func (p *PostManager) GetTotalCount() int {
-	return len(p.orderedList)
+	return posts, totalPages, hasNext, hasPrev
 }
 
 func (p *PostManager) buildPost(key string) (*Post, error) {
-	filename := "content/posts/" + key + ".md"
-	fileContent, err := fs.ReadFile(ContentFS, filename)
+	filename := path.Join(PostsDir, key+".md")
+
+	// Bundled posts are a directory with the markdown and the post's images and files
+	bundled := isPostBundle(p.site.content, key)
+	if bundled {
+		if _, err := fs.Stat(p.site.content, filename); err == nil {
+			return nil, errors.Errorf("post %s is both %s and a bundle", key, filename)
+		}
+
+		filename = path.Join(PostsDir, key, bundleIndex)
+	}
+
+	fileContent, err := fs.ReadFile(p.site.content, filename)
 	if err != nil {
 		if _, ok := err.(*fs.PathError); ok {
 			return nil, nil
@@ -167,12 +531,21 @@ func (p *PostManager) buildPost(key string) (*Post, error) {
 		return nil, errors.Wrapf(err, "problem getting published date from %s", filename)
 	}
 
-	now := time.Now()
+	// Updates are optional and may say what changed
+	updatedAt := time.Time{}
+	if _, ok := front["updated"]; ok {
+		updatedAt, err = getDateFromFrontMatter(front, "updated")
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem getting updated date from %s", filename)
+		}
+	}
 
-	// If no published date, skip
-	if now.Before(publishedAt) && p.site.Env == "production" {
-		log.Infof("Skipping %s, not published", key)
-		return nil, ErrNotPublished
+	updateNote := ""
+	if _, ok := front["update_note"]; ok {
+		updateNote, err = getStringFromFrontMatter(front, "update_note")
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem getting update note from %s", filename)
+		}
 	}
 
 	// Get details from parsed html
@@ -196,47 +569,211 @@ func (p *PostManager) buildPost(key string) (*Post, error) {
 		log.Warnf("problem getting url from %s", filename)
 	}
 
-	// Run markdown through page template
-	buf := &bytes.Buffer{}
-	err = p.templates.ExecuteTemplate(buf, "post.tmpl", &TemplateData{
-		Key:         key,
+	// Feeds need a link to every post
+	if url == "" {
+		url = getPostUrl(p.site.Env, key)
+	}
+
+	tags, err := getStringsFromFrontMatter(front, "tags")
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem getting tags from %s", filename)
+	}
+
+	for idx, tag := range tags {
+		tags[idx] = slugify(tag)
+	}
+
+	category := ""
+	if _, ok := front["category"]; ok {
+		category, err = getStringFromFrontMatter(front, "category")
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem getting category from %s", filename)
+		}
+
+		category = slugify(category)
+	}
+
+	aliases, err := getStringsFromFrontMatter(front, "aliases")
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem getting aliases from %s", filename)
+	}
+
+	gone := false
+	if _, ok := front["gone"]; ok {
+		gone, err = getBoolFromFrontMatter(front, "gone")
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem getting gone from %s", filename)
+		}
+	}
+
+	authorIds, err := getStringsFromFrontMatter(front, "authors")
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem getting authors from %s", filename)
+	}
+
+	authors, err := p.authors.GetByIds(authorIds)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem getting authors from %s", filename)
+	}
+
+	series := ""
+	if _, ok := front["series"]; ok {
+		series, err = getStringFromFrontMatter(front, "series")
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem getting series from %s", filename)
+		}
+	}
+
+	seriesOrder := 0
+	if _, ok := front["series_order"]; ok {
+		seriesOrder, err = getIntFromFrontMatter(front, "series_order")
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem getting series order from %s", filename)
+		}
+	}
+
+	files := map[string]*Asset{}
+	if bundled {
+		files, err = getBundleFiles(p.site.content, key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading files bundled with %s", filename)
+		}
+
+		base := getBundleBase(key)
+		resolved, err := resolveBundleLinks(*body, base)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem resolving links in %s", filename)
+		}
+
+		body = &resolved
+		image = getBundlePath(image, base)
+	}
+
+	// Posts can have their own styles and script next to the markdown, slug.css and slug.js or index.css and
+	// index.js in a bundle
+	sidecar := strings.TrimSuffix(filename, ".md")
+	postCSS, err := getCSS(p.site.content, sidecar)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading styles for %s", filename)
+	}
+
+	javaScript, err := getJavaScript(p.site.content, sidecar)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading script for %s", filename)
+	}
+
+	// Shared stylesheets and scripts, e.g. a library used by a few posts
+	styleNames, err := getStringsFromFrontMatter(front, "styles")
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem getting styles from %s", filename)
+	}
+
+	styles, err := getAssetURLs(styleNames, *p.hashes, getBundleBase(key), files)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem getting styles from %s", filename)
+	}
+
+	scriptNames, err := getStringsFromFrontMatter(front, "scripts")
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem getting scripts from %s", filename)
+	}
+
+	scripts, err := getAssetURLs(scriptNames, *p.hashes, getBundleBase(key), files)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem getting scripts from %s", filename)
+	}
+
+	stats, err := getStats(*body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem getting stats for %s", filename)
+	}
+
+	feedContent, err := getFeedContent(*body, url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem preparing feed content for %s", filename)
+	}
+
+	return &Post{
+		Slug:        key,
 		Title:       title,
-		CSS:         css.String(),
-		JavaScript:  "",
-		Content:     string((*body)[:]),
-		Site:        p.site,
-		Generated:   time.Now(),
+		Image:       image,
+		Intro:       intro,
 		PublishedAt: publishedAt,
+		UpdatedAt:   updatedAt,
+		UpdateNote:  updateNote,
+		Body:        body,
+		FeedContent: feedContent,
+		Url:         url,
+		Tags:        tags,
+		Category:    category,
+		Authors:     authors,
+		Series:      series,
+		SeriesOrder: seriesOrder,
+		Aliases:     aliases,
+		Gone:        gone,
 		Social: &Social{
 			Title:       title,
 			Description: intro,
 			ImageUrl:    image,
 			Url:         url,
 		},
+		Styles:     styles,
+		Scripts:    scripts,
+		Stats:      stats,
+		css:        template.CSS(css.String() + string(*postCSS)),
+		javaScript: template.JS(*javaScript),
+		files:      files,
+	}, nil
+}
+
+// renderPost runs the post through the post template, p.mu must be held as the post's series is included
+func (p *PostManager) renderPost(post *Post) error {
+	// Scheduled posts aren't part of their series until they're published
+	var series *SeriesData
+	if parts, ok := p.series[seriesDir+"/"+slugify(post.Series)]; ok && post.Series != "" {
+		series = parts.GetData(post)
+	}
+
+	buf := &bytes.Buffer{}
+	err := p.templates.ExecuteTemplate(buf, "post.tmpl", &TemplateData{
+		Key:         post.Slug,
+		Title:       post.Title,
+		CSS:         post.css,
+		JavaScript:  post.javaScript,
+		Styles:      post.Styles,
+		Scripts:     post.Scripts,
+		Stats:       post.Stats,
+		Content:     template.HTML(*post.Body),
+		Site:        p.site,
+		Hashes:      p.hashes,
+		Generated:   time.Now(),
+		PublishedAt: post.PublishedAt,
+		UpdatedAt:   post.UpdatedAt,
+		UpdateNote:  post.UpdateNote,
+		Tags:        post.Tags,
+		Category:    post.Category,
+		Series:      series,
+		Authors:     post.Authors,
+		Config:      p.config,
+		SiteAuthor:  p.authors.GetDefault(),
+		Social:      post.Social,
 	})
 	if err != nil {
-		return nil, err
+		return errors.Wrapf(err, "problem rendering post %s", post.Slug)
 	}
 
 	content := buf.Bytes()
+	post.Content = &content
+	post.Etag = getEtag(&content)
 
-	return &Post{
-		Slug:        key,
-		Title:       title,
-		Image:       image,
-		Intro:       intro,
-		PublishedAt: publishedAt,
-		Content:     &content,
-		Etag:        getEtag(&content),
-		Url:         url,
-	}, nil
+	return nil
 }
 
 func renderMarkdown(markdown *[]byte) (*[]byte, *bytes.Buffer, error) {
 	// Defines the extensions that are used
 	var exts = bf.NoIntraEmphasis | bf.Tables | bf.FencedCode | bf.Autolink |
 		bf.Strikethrough | bf.SpaceHeadings | bf.BackslashLineBreak |
-		bf.DefinitionLists | bf.Footnotes
+		bf.DefinitionLists | bf.Footnotes | bf.AutoHeadingIDs
 
 	// Defines the HTML rendering flags that are used
 	var flags = bf.UseXHTML | bf.Smartypants | bf.SmartypantsFractions |
@@ -270,6 +807,10 @@ func renderMarkdown(markdown *[]byte) (*[]byte, *bytes.Buffer, error) {
 }
 
 func getPostUrl(env string, key string) string {
+	return fmt.Sprintf("%s/posts/%s", getSiteUrl(env), key)
+}
+
+func getSiteUrl(env string) string {
 	domain := "test.pedanticorderliness.com"
 	if env == "production" {
 		domain = "www.pedanticorderliness.com"
@@ -277,5 +818,5 @@ func getPostUrl(env string, key string) string {
 		domain = "test.pedanticorderliness.com"
 	}
 
-	return fmt.Sprintf("https://%s/posts/%s", domain, key)
+	return fmt.Sprintf("https://%s", domain)
 }
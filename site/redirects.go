@@ -0,0 +1,94 @@
+package site
+
+import (
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// RedirectsFile maps old paths to new ones and lists paths that are gone for good
+const RedirectsFile = "redirects.yaml"
+
+type Redirects struct {
+	Redirects map[string]string `yaml:"redirects"`
+	Gone      []string          `yaml:"gone"`
+
+	gone map[string]bool
+}
+
+func LoadRedirects(content fs.FS) (*Redirects, error) {
+	redirects := &Redirects{
+		Redirects: map[string]string{},
+		gone:      map[string]bool{},
+	}
+
+	data, err := fs.ReadFile(content, RedirectsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return redirects, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading %s", RedirectsFile)
+	}
+
+	err = yaml.UnmarshalStrict(data, redirects)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem parsing %s", RedirectsFile)
+	}
+
+	// Paths are matched cleaned, so "/old/" and "/old" are the same rule
+	rules := map[string]string{}
+	for from, to := range redirects.Redirects {
+		if to == "" {
+			return nil, errors.Errorf("redirect of %s in %s has no target", from, RedirectsFile)
+		}
+
+		rules[cleanRedirectPath(from)] = to
+	}
+	redirects.Redirects = rules
+
+	for _, gone := range redirects.Gone {
+		redirects.gone[cleanRedirectPath(gone)] = true
+	}
+
+	return redirects, nil
+}
+
+func cleanRedirectPath(location string) string {
+	return path.Clean("/" + strings.TrimSpace(location))
+}
+
+// getRedirect returns where a path has moved to, or that it's gone. The redirects file is checked before posts.
+func (s *Snapshot) getRedirect(location string) (string, bool) {
+	location = cleanRedirectPath(location)
+
+	if target, ok := s.Redirects.Redirects[location]; ok {
+		return target, false
+	}
+	if s.Redirects.gone[location] {
+		return "", true
+	}
+
+	return s.posts.GetRedirect(location)
+}
+
+// matchRedirect routes requests for moved and retired paths to redirectHandler, ahead of the other routes
+func (s *Site) matchRedirect(r *http.Request, match *mux.RouteMatch) bool {
+	target, gone := s.getSnapshot().getRedirect(r.URL.Path)
+
+	return target != "" || gone
+}
+
+func (s *Site) redirectHandler(w http.ResponseWriter, r *http.Request) {
+	target, gone := s.getSnapshot().getRedirect(r.URL.Path)
+	if gone {
+		s.Handle410(w, r)
+		return
+	}
+
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
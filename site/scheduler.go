@@ -0,0 +1,105 @@
+package site
+
+import (
+	"time"
+)
+
+// publishRetry is how long the scheduler waits before trying to publish posts that failed to publish again
+const publishRetry = time.Minute
+
+// Scheduler publishes future dated posts once their published time has passed
+type Scheduler struct {
+	site *Site
+	wake chan struct{}
+	stop chan struct{}
+
+	// Posts that failed to publish aren't tried again until then, or until the content is reloaded
+	retryAt time.Time
+}
+
+func NewScheduler(site *Site) *Scheduler {
+	return &Scheduler{
+		site: site,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+}
+
+func (s *Scheduler) Start() {
+	go s.run()
+}
+
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+// Wake makes the scheduler look for the next scheduled post again, e.g. after content is reloaded
+func (s *Scheduler) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) run() {
+	for {
+		var timer *time.Timer
+		var due <-chan time.Time
+
+		next, ok := s.site.getSnapshot().posts.NextScheduled()
+		if ok && next.Before(s.retryAt) {
+			next = s.retryAt
+		}
+
+		if ok {
+			s.site.Log.Infof("Next scheduled post is due at %s", next.Format(time.RFC3339))
+			timer = time.NewTimer(time.Until(next))
+			due = timer.C
+		} else {
+			s.site.Log.Debug("No posts scheduled")
+		}
+
+		select {
+		case <-due:
+			s.publish()
+		case <-s.wake:
+			s.retryAt = time.Time{}
+		case <-s.stop:
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+	}
+}
+
+// publish swaps in a copy of the snapshot with the posts that are due published, requests keep being served from
+// the current snapshot while the copy is built
+func (s *Scheduler) publish() {
+	// Dev mode and content reloads change the snapshot too
+	s.site.mu.Lock()
+	defer s.site.mu.Unlock()
+	s.site.reloadMu.Lock()
+	defer s.site.reloadMu.Unlock()
+
+	// The posts stay scheduled in the current snapshot if the copy can't be built
+	snapshot, published, err := s.site.publishScheduled(s.site.getSnapshot(), time.Now())
+	if err != nil {
+		s.retryAt = time.Now().Add(publishRetry)
+		s.site.Log.WithError(err).Errorf("Problem publishing scheduled posts, trying again at %s",
+			s.retryAt.Format(time.RFC3339))
+		return
+	}
+
+	s.site.snapshot.Store(snapshot)
+
+	for _, post := range published {
+		s.site.Log.Infof("Published scheduled post %s", post.Slug)
+	}
+}
@@ -0,0 +1,92 @@
+package site
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Run with -race, requests are served from the current snapshot while the scheduler publishes in to a new one
+func TestSchedulerPublishesUnderConcurrentRequests(t *testing.T) {
+	logrus.SetOutput(io.Discard)
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	due := time.Now().Add(3 * time.Second)
+	scheduled := fstest.MapFS{
+		"posts/scheduled_post.md": &fstest.MapFile{Data: []byte(fmt.Sprintf(
+			"---\ntitle: Scheduled\npublished: %s\nintro: Due soon\ntags: [scheduled]\n---\n\nPublished on time.\n",
+			due.UTC().Format(time.RFC3339Nano)))},
+	}
+
+	s := NewSite("", "production", logrus.NewEntry(log))
+	s.SetContentFS(NewOverlayFS(scheduled, os.DirFS("../content")))
+	s.SetThemeFS(os.DirFS("../themes/default"))
+	if err := s.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		s.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		return recorder
+	}
+
+	if code := get("/posts/scheduled_post").Code; code != http.StatusNotFound {
+		t.Fatalf("scheduled post answered %d before it was due", code)
+	}
+
+	scheduler := NewScheduler(s)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	stop := make(chan struct{})
+	wg := sync.WaitGroup{}
+	for _, target := range []string{"/posts/scheduled_post", "/", "/tags/scheduled", "/rss.xml", "/sitemap.xml"} {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				// Nothing sends an Etag, a 304 means a post was served before it was rendered
+				if code := get(target).Code; code == http.StatusNotModified {
+					t.Errorf("%s answered %d", target, code)
+				}
+			}
+		}(target)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for get("/posts/scheduled_post").Code != http.StatusOK {
+		if time.Now().After(deadline) {
+			close(stop)
+			wg.Wait()
+			t.Fatal("scheduled post wasn't published")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(stop)
+	wg.Wait()
+
+	for _, target := range []string{"/", "/tags/scheduled", "/rss.xml", "/sitemap.xml"} {
+		if !strings.Contains(get(target).Body.String(), "/posts/scheduled_post") {
+			t.Errorf("%s doesn't list the published post", target)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package site
+
+import (
+	"sort"
+)
+
+const seriesDir = "series"
+
+// Series is a set of posts meant to be read in order, posts join one with the series and series_order front matter
+type Series struct {
+	Key   string
+	Title string
+	Path  string
+	Posts []*Post
+}
+
+// SeriesData places a post within its series for post.tmpl
+type SeriesData struct {
+	Title string
+	Path  string
+	Posts []*Post
+	Part  int
+	Prev  *Post
+	Next  *Post
+}
+
+// getSeries groups posts by series, ordering each by series_order and then by when parts were published
+func getSeries(posts []*Post) map[string]*Series {
+	series := map[string]*Series{}
+	for _, post := range posts {
+		if post.Series == "" {
+			continue
+		}
+
+		key := seriesDir + "/" + slugify(post.Series)
+		if _, ok := series[key]; !ok {
+			series[key] = &Series{
+				Key:   key,
+				Title: post.Series,
+				Path:  "/" + key,
+			}
+		}
+
+		series[key].Posts = append(series[key].Posts, post)
+	}
+
+	for _, item := range series {
+		parts := item.Posts
+		sort.SliceStable(parts, func(i, j int) bool {
+			if parts[i].SeriesOrder == parts[j].SeriesOrder {
+				return parts[i].PublishedAt.Before(parts[j].PublishedAt)
+			}
+
+			return parts[i].SeriesOrder < parts[j].SeriesOrder
+		})
+	}
+
+	return series
+}
+
+// GetData returns the post's place in the series, nil if the post isn't part of it
+func (s *Series) GetData(post *Post) *SeriesData {
+	for idx, part := range s.Posts {
+		if part != post {
+			continue
+		}
+
+		data := &SeriesData{
+			Title: s.Title,
+			Path:  s.Path,
+			Posts: s.Posts,
+			Part:  idx + 1,
+		}
+
+		if idx > 0 {
+			data.Prev = s.Posts[idx-1]
+		}
+		if idx < len(s.Posts)-1 {
+			data.Next = s.Posts[idx+1]
+		}
+
+		return data
+	}
+
+	return nil
+}
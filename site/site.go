@@ -1,13 +1,19 @@
 package site
 
 import (
-	"embed"
+	"crypto/subtle"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"strconv"
-
-	//"strings"
-	"text/template"
+	"strings"
+	"sync"
+
+	"os"
+	"os/signal"
+	"path"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/handlers"
@@ -15,30 +21,38 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// Directories within the content FS, the root of the FS is the content directory
 const (
-	ContentDir  = "./content/"
+	ContentDir  = "."
 	TemplateDir = ContentDir
 	PagesDir    = ContentDir
-	PostsDir    = ContentDir + "posts/"
-	AssetsDir   = ContentDir + "static/"
+	PostsDir    = "posts"
+	AssetsDir   = "static"
 )
 
 type Hashes map[string]string
 
-var ContentFS embed.FS
-
 type Site struct {
-	port   string
-	Env    string
-	Log    *logrus.Entry
-	Hashes *Hashes
+	port       string
+	Env        string
+	Dev        bool
+	Log        *logrus.Entry
+	adminToken string
+	content    fs.FS
+	theme      fs.FS
 
 	router *mux.Router
 
-	pages     *PageManager
-	posts     *PostManager
-	assets    *AssetManager
-	templates *template.Template
+	// Requests are served from the current snapshot, reloads swap in a new one
+	snapshot atomic.Pointer[Snapshot]
+	reloadMu sync.Mutex
+
+	// Held for writing while dev mode swaps in rebuilt content
+	mu      sync.RWMutex
+	watcher *Watcher
+	reloads *ReloadBroker
+
+	scheduler *Scheduler
 }
 
 func NewSite(port string, env string, log *logrus.Entry) *Site {
@@ -49,49 +63,116 @@ func NewSite(port string, env string, log *logrus.Entry) *Site {
 	}
 }
 
-func (s *Site) SetContentFS(fs embed.FS) {
-	ContentFS = fs
+// SetContentFS sets where content is read from, see OpenContent and NewOverlayFS
+func (s *Site) SetContentFS(content fs.FS) {
+	s.content = content
 }
 
-func (s *Site) Run() error {
-	var err error
+// SetThemeFS sets the theme providing the default templates and assets, the content may override any of them
+func (s *Site) SetThemeFS(theme fs.FS) {
+	s.theme = theme
+}
 
-	s.assets = NewAssetManager("")
-	if err := s.assets.Load(); err != nil {
-		return err
+// getThemedFS layers the content over the theme, templates and assets are resolved through it
+func (s *Site) getThemedFS() fs.FS {
+	if s.theme == nil {
+		return s.content
 	}
 
-	s.Hashes = s.assets.GetHashes()
+	return NewOverlayFS(s.content, s.theme)
+}
 
-	// Load templates that we will use to render pages and posts
-	s.templates, err = LoadTemplates("content")
-	if err != nil {
-		return err
-	}
+// SetDev enables dev mode, content is watched for changes and open pages reload when it changes
+func (s *Site) SetDev(dev bool) {
+	s.Dev = dev
+}
 
-	s.posts = NewPostManager(s, "", s.templates)
-	if err := s.posts.Load(); err != nil {
-		return err
-	}
+// SetAdminToken enables the reload endpoint for requests bearing the token
+func (s *Site) SetAdminToken(token string) {
+	s.adminToken = token
+}
 
-	// Create caches for our various content types
-	s.pages = NewPageManager(s, "", s.templates, s.posts)
-	if err := s.pages.Load(); err != nil {
+// Load builds the caches and routing shared by the server and the static export
+func (s *Site) Load() error {
+	snapshot, err := s.buildSnapshot()
+	if err != nil {
 		return err
 	}
 
+	s.snapshot.Store(snapshot)
+
 	// Prepare routing
 	router := mux.NewRouter()
+	router.MatcherFunc(s.matchRedirect).HandlerFunc(s.redirectHandler).Methods("GET")
+	if s.adminToken != "" {
+		router.HandleFunc("/_admin/reload", s.adminReloadHandler).Methods("POST")
+	}
 	router.HandleFunc("/posts/{key}", s.postHandler).Methods("GET")
+	router.HandleFunc("/posts/{key}/{file:.+}", s.postFileHandler).Methods("GET")
 	router.HandleFunc("/static/{key}", s.staticHandler).Methods("GET")
+	router.HandleFunc("/{taxonomy:tags|categories|authors}/{term}/rss.xml", s.taxonomyFeedHandler).Methods("GET")
+	router.HandleFunc("/{taxonomy:tags|categories|authors}/{term}/page/{page:[0-9]+}", s.taxonomyHandler).Methods("GET")
+	router.HandleFunc("/{taxonomy:tags|categories|authors}/{term}", s.taxonomyHandler).Methods("GET")
 	router.HandleFunc("/favicon.ico", s.faviconHandler).Methods("GET")
 	router.HandleFunc("/robots.txt", s.robotsHandler).Methods("GET")
-	router.HandleFunc("/{key}", s.pageHandler).Methods("GET")
+	router.HandleFunc("/page/{page:[0-9]+}", s.pageHandler).Methods("GET")
+	router.HandleFunc("/series/{name}", s.seriesHandler).Methods("GET")
+	router.HandleFunc("/archive/{year:[0-9]{4}}", s.archiveHandler).Methods("GET")
+	router.HandleFunc("/archive/{year:[0-9]{4}}/{month:[0-9]{2}}", s.archiveHandler).Methods("GET")
+	router.HandleFunc("/{key:.+}", s.pageHandler).Methods("GET")
 	router.HandleFunc("/", s.pageHandler).Methods("GET")
 	router.HandleFunc("", s.pageHandler).Methods("GET")
 	s.router = router
 
-	loggingHandler := handlers.LoggingHandler(s.Log.Writer(), router)
+	return nil
+}
+
+// Validate loads all of the content and templates, returning the first problem found
+func (s *Site) Validate() error {
+	err := s.Load()
+	if err != nil {
+		return err
+	}
+
+	snapshot := s.getSnapshot()
+	s.Log.Infof("Loaded %d posts, %d pages, and %d assets", len(snapshot.posts.GetKeys()),
+		len(snapshot.pages.GetKeys()), len(snapshot.assets.GetKeys()))
+
+	return nil
+}
+
+func (s *Site) Run() error {
+	err := s.Load()
+	if err != nil {
+		return err
+	}
+
+	// Publish future dated posts when they come due
+	s.scheduler = NewScheduler(s)
+	s.scheduler.Start()
+	defer s.scheduler.Stop()
+
+	// SIGHUP rebuilds the content without dropping requests
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+	go s.reloadOnSignal(hangups)
+
+	var handler http.Handler = s.router
+
+	// Watch the content for changes and push reloads to open pages
+	if s.Dev {
+		s.reloads = NewReloadBroker()
+		s.watcher = NewWatcher(s, watchInterval)
+		if err := s.watcher.Start(); err != nil {
+			return err
+		}
+		defer s.watcher.Stop()
+
+		handler = s.devHandler(s.router)
+	}
+
+	loggingHandler := handlers.LoggingHandler(s.Log.Writer(), handler)
 
 	// Prepare server
 	server := http.Server{
@@ -112,44 +193,118 @@ func (s *Site) Run() error {
 	return nil
 }
 
+func (s *Site) reloadOnSignal(hangups chan os.Signal) {
+	for range hangups {
+		s.Log.Info("Received SIGHUP, reloading content")
+
+		err := s.Reload()
+		if err != nil {
+			s.Log.WithError(err).Error("Problem reloading content, still serving previous content")
+			continue
+		}
+
+		s.Log.Info("Reloaded content")
+	}
+}
+
+func (s *Site) adminReloadHandler(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err := s.Reload()
+	if err != nil {
+		s.Log.WithError(err).Error("Problem reloading content, still serving previous content")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	s.Log.Info("Reloaded content")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Reloaded"))
+}
+
 func (s *Site) pageHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := vars["key"]
 
 	// The root page uses the "index" key
 	if key == "" {
-		key = "index"
-		
-		// Handle pagination for index page
-		pageParam := r.URL.Query().Get("page")
-		if pageParam != "" {
-			pageNum, err := strconv.Atoi(pageParam)
-			if err != nil || pageNum < 1 {
-				pageNum = 1
-			}
-			
-			page := s.pages.GetPaginated("index", pageNum)
-			if page == nil {
-				s.Handle404(w, r)
-				return
-			}
-			
-			if r.Header.Get("If-None-Match") == page.Etag {
-				w.WriteHeader(http.StatusNotModified)
-				return
-			}
-
-			w.Header().Set("Content-Type", page.Mime)
-			w.Header().Set("Cache-Control", page.CacheControl)
-			w.Header().Set("Etag", page.Etag)
-			w.WriteHeader(http.StatusOK)
-			w.Write(*page.Content)
-			return
-		}
+		s.serveList(w, r, indexKey, "/")
+		return
 	}
 
 	// Try to get cache page
-	page := s.pages.Get(key)
+	s.servePage(w, r, s.getSnapshot().pages.Get(key))
+}
+
+func (s *Site) taxonomyHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := vars["taxonomy"] + "/" + vars["term"]
+
+	s.serveList(w, r, key, "/"+key)
+}
+
+func (s *Site) taxonomyFeedHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := vars["taxonomy"] + "/" + vars["term"] + "/" + rssKey
+
+	s.servePage(w, r, s.getSnapshot().pages.Get(key))
+}
+
+func (s *Site) archiveHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := path.Join(archiveKey, vars["year"], vars["month"])
+
+	s.servePage(w, r, s.getSnapshot().pages.Get(key))
+}
+
+func (s *Site) seriesHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	key := seriesDir + "/" + vars["name"]
+
+	s.servePage(w, r, s.getSnapshot().pages.Get(key))
+}
+
+// serveList serves a page of a listing from its /page/{n} path, other ways of asking for a page redirect there
+func (s *Site) serveList(w http.ResponseWriter, r *http.Request, key string, listPath string) {
+	// Query string pagination is from before listings had page paths
+	pageParam := r.URL.Query().Get("page")
+	if pageParam != "" {
+		pageNum, err := strconv.Atoi(pageParam)
+		if err != nil || pageNum < 1 {
+			pageNum = 1
+		}
+
+		http.Redirect(w, r, GetPageURL(listPath, pageNum), http.StatusMovedPermanently)
+		return
+	}
+
+	pageVar, ok := mux.Vars(r)["page"]
+	if !ok {
+		s.servePage(w, r, s.getSnapshot().pages.Get(key))
+		return
+	}
+
+	pageNum, err := strconv.Atoi(pageVar)
+	if err != nil {
+		s.Handle404(w, r)
+		return
+	}
+
+	// The first page is the listing itself
+	if pageNum <= 1 {
+		http.Redirect(w, r, listPath, http.StatusMovedPermanently)
+		return
+	}
+
+	s.servePage(w, r, s.getSnapshot().pages.GetPaginated(key, pageNum))
+}
+
+func (s *Site) servePage(w http.ResponseWriter, r *http.Request, page *Page) {
 	if page == nil {
 		s.Handle404(w, r)
 		return
@@ -163,6 +318,9 @@ func (s *Site) pageHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", page.Mime)
 	w.Header().Set("Cache-Control", page.CacheControl)
 	w.Header().Set("Etag", page.Etag)
+	if page.Link != "" {
+		w.Header().Set("Link", page.Link)
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write(*page.Content)
 }
@@ -172,7 +330,7 @@ func (s *Site) postHandler(w http.ResponseWriter, r *http.Request) {
 	key := vars["key"]
 
 	// Try to get cache entry for post
-	post := s.posts.Get(key)
+	post := s.getSnapshot().posts.Get(key)
 	if post == nil {
 		s.Handle404(w, r)
 		return
@@ -183,19 +341,59 @@ func (s *Site) postHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Etags take precedence, dates are only compared for clients that don't send one
+	lastModified := post.GetUpdatedAt().UTC().Truncate(time.Second)
+	if r.Header.Get("If-None-Match") == "" {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err == nil && !lastModified.After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("Cache-Control", "public, must-revalidate")
 	w.Header().Set("Etag", post.Etag)
+	w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
 	w.WriteHeader(http.StatusOK)
 	w.Write(*post.Content)
 }
 
+// postFileHandler serves the images and files bundled with a post
+func (s *Site) postFileHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	post := s.getSnapshot().posts.Get(vars["key"])
+	if post == nil {
+		s.Handle404(w, r)
+		return
+	}
+
+	file := post.GetFile(vars["file"])
+	if file == nil {
+		s.Handle404(w, r)
+		return
+	}
+
+	if r.Header.Get("If-None-Match") == file.Etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	// Bundled files keep their names when they change, unlike the hashed static assets
+	w.Header().Set("Content-Type", file.Mime)
+	w.Header().Set("Cache-Control", "public, must-revalidate")
+	w.Header().Set("Etag", file.Etag)
+	w.WriteHeader(http.StatusOK)
+	w.Write(*file.Content)
+}
+
 func (s *Site) staticHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	key := vars["key"]
 
 	// Try to get cached entry for asset
-	asset := s.assets.Get(key)
+	asset := s.getSnapshot().assets.Get(key)
 	if asset == nil {
 		s.Handle404(w, r)
 		return
@@ -214,7 +412,7 @@ func (s *Site) staticHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Site) faviconHandler(w http.ResponseWriter, r *http.Request) {
-	asset := s.assets.Get("favicon.ico")
+	asset := s.getSnapshot().assets.Get("favicon.ico")
 	if asset == nil {
 		s.Handle404(w, r)
 		return
@@ -233,7 +431,7 @@ func (s *Site) robotsHandler(w http.ResponseWriter, r *http.Request) {
 		robotsFile = "disallow.txt"
 	}
 
-	asset := s.assets.Get(robotsFile)
+	asset := s.getSnapshot().assets.Get(robotsFile)
 	if asset == nil {
 		s.Handle404(w, r)
 		return
@@ -242,10 +440,15 @@ func (s *Site) robotsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", asset.Mime)
 	w.WriteHeader(http.StatusOK)
 	w.Write(*asset.Content)
+
+	// Only production is crawled
+	if s.Env == "production" {
+		fmt.Fprintf(w, "\nSitemap: %s/%s\n", getSiteUrl(s.Env), sitemapKey)
+	}
 }
 
 func (s *Site) Handle404(w http.ResponseWriter, r *http.Request) {
-	page := s.pages.Get("404")
+	page := s.getSnapshot().pages.Get("404")
 	if page == nil {
 		s.Handle500(w, r)
 		return
@@ -256,8 +459,24 @@ func (s *Site) Handle404(w http.ResponseWriter, r *http.Request) {
 	w.Write(*page.Content)
 }
 
+// Handle410 answers for content that was retired on purpose, the 404 page is used if there isn't a 410 page
+func (s *Site) Handle410(w http.ResponseWriter, r *http.Request) {
+	page := s.getSnapshot().pages.Get("410")
+	if page == nil {
+		page = s.getSnapshot().pages.Get("404")
+	}
+	if page == nil {
+		s.Handle500(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusGone)
+	w.Write(*page.Content)
+}
+
 func (s *Site) Handle500(w http.ResponseWriter, r *http.Request) {
-	page := s.pages.Get("500")
+	page := s.getSnapshot().pages.Get("500")
 	if page == nil {
 		s.Log.Warn("Unable to get 500 page")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -0,0 +1,87 @@
+package site
+
+import (
+	"encoding/xml"
+	"sort"
+	"strings"
+	"time"
+)
+
+const sitemapKey = "sitemap.xml"
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// Sitemap is a sitemaps.org urlset, https://www.sitemaps.org/protocol.html
+type Sitemap struct {
+	XMLName xml.Name     `xml:"urlset"`
+	NS      string       `xml:"xmlns,attr"`
+	Urls    []SitemapUrl `xml:"url"`
+}
+
+type SitemapUrl struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// buildSitemap lists every page, post, and page of a listing, it's rebuilt whenever any of those change
+func (p *PageManager) buildSitemap() error {
+	siteUrl := getSiteUrl(p.site.Env)
+	lastMods := map[string]time.Time{}
+
+	for _, post := range p.posts.GetAll() {
+		lastMods["/posts/"+post.Slug] = post.GetUpdatedAt()
+	}
+
+	// Listings change when the most recently updated post in them does
+	for _, item := range p.lists.GetValues() {
+		list := item.(*postList)
+
+		lastMod := time.Time{}
+		for _, post := range list.Posts {
+			if post.GetUpdatedAt().After(lastMod) {
+				lastMod = post.GetUpdatedAt()
+			}
+		}
+
+		for pageNum := 1; pageNum <= len(list.Pages); pageNum++ {
+			lastMods[GetPageURL(list.Path, pageNum)] = lastMod
+		}
+	}
+
+	// Markdown pages don't have dates, pages asking not to be indexed are left out
+	for _, key := range p.cache.GetKeys() {
+		page := p.Get(key)
+		if page == nil || !strings.HasPrefix(page.Mime, "text/html") || isErrorPage(key) || page.NoIndex {
+			continue
+		}
+
+		loc := "/" + key
+		if key == indexKey {
+			loc = "/"
+		}
+
+		if _, ok := lastMods[loc]; !ok {
+			lastMods[loc] = time.Time{}
+		}
+	}
+
+	locs := []string{}
+	for loc := range lastMods {
+		locs = append(locs, loc)
+	}
+	sort.Strings(locs)
+
+	sitemap := &Sitemap{
+		NS: sitemapNamespace,
+	}
+
+	for _, loc := range locs {
+		url := SitemapUrl{Loc: siteUrl + loc}
+		if !lastMods[loc].IsZero() {
+			url.LastMod = lastMods[loc].UTC().Format(time.RFC3339)
+		}
+
+		sitemap.Urls = append(sitemap.Urls, url)
+	}
+
+	return p.setFeed(sitemapKey, "application/xml; charset=utf-8", sitemap)
+}
@@ -0,0 +1,121 @@
+package site
+
+import (
+	"html/template"
+	"time"
+)
+
+// Snapshot is a complete build of the site's content. Requests are served from the current snapshot and
+// reloads build a new one in the background, swapping it in only once everything has built.
+type Snapshot struct {
+	Hashes    *Hashes
+	Config    *Config
+	Authors   *Authors
+	Redirects *Redirects
+	templates *template.Template
+	assets    *AssetManager
+	posts     *PostManager
+	pages     *PageManager
+}
+
+// buildSnapshot builds the asset, template, post, and page caches
+func (s *Site) buildSnapshot() (*Snapshot, error) {
+	var err error
+	snapshot := &Snapshot{}
+	themed := s.getThemedFS()
+
+	snapshot.Config, err = LoadConfig(s.content)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.Authors, err = LoadAuthors(s.content, snapshot.Config.Author)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.Redirects, err = LoadRedirects(s.content)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.assets = NewAssetManager(themed, "")
+	if err := snapshot.assets.Load(); err != nil {
+		return nil, err
+	}
+
+	snapshot.Hashes = snapshot.assets.GetHashes()
+
+	// Load templates that we will use to render pages and posts
+	snapshot.templates, err = LoadTemplates(themed, TemplateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot.posts = NewPostManager(s, "", snapshot.templates, snapshot.Hashes, snapshot.Config,
+		snapshot.Authors)
+	if err := snapshot.posts.Load(); err != nil {
+		return nil, err
+	}
+
+	// Create caches for our various content types
+	snapshot.pages = NewPageManager(s, "", snapshot.templates, snapshot.Hashes, snapshot.Config,
+		snapshot.Authors, snapshot.posts)
+	if err := snapshot.pages.Load(); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
+
+// publishScheduled builds a copy of current with the scheduled posts that are due by now published. Only the
+// pages are read from the content again, current isn't changed and keeps serving until the copy is swapped in.
+func (s *Site) publishScheduled(current *Snapshot, now time.Time) (*Snapshot, []*Post, error) {
+	snapshot := &Snapshot{
+		Hashes:    current.Hashes,
+		Config:    current.Config,
+		Authors:   current.Authors,
+		Redirects: current.Redirects,
+		templates: current.templates,
+		assets:    current.assets,
+	}
+
+	snapshot.posts = NewPostManager(s, "", snapshot.templates, snapshot.Hashes, snapshot.Config,
+		snapshot.Authors)
+	published, err := snapshot.posts.LoadPublished(current.posts, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	snapshot.pages = NewPageManager(s, "", snapshot.templates, snapshot.Hashes, snapshot.Config,
+		snapshot.Authors, snapshot.posts)
+	if err := snapshot.pages.Load(); err != nil {
+		return nil, nil, err
+	}
+
+	return snapshot, published, nil
+}
+
+func (s *Site) getSnapshot() *Snapshot {
+	return s.snapshot.Load()
+}
+
+// Reload builds a new snapshot and swaps it in, the current snapshot keeps serving if the build fails
+func (s *Site) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	snapshot, err := s.buildSnapshot()
+	if err != nil {
+		return err
+	}
+
+	s.snapshot.Store(snapshot)
+
+	// Scheduled posts may have been added or removed
+	if s.scheduler != nil {
+		s.scheduler.Wake()
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package site
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// OpenContent opens a content directory, or a .zip, .tar, .tar.gz, or .tgz bundle of one
+func OpenContent(location string) (fs.FS, error) {
+	info, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return os.DirFS(location), nil
+	}
+
+	data, err := os.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+
+	var content fs.FS
+	switch {
+	case strings.HasSuffix(location, ".zip"):
+		content, err = zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	case strings.HasSuffix(location, ".tar"):
+		content, err = readTar(bytes.NewReader(data))
+	case strings.HasSuffix(location, ".tar.gz") || strings.HasSuffix(location, ".tgz"):
+		var reader *gzip.Reader
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+		if err == nil {
+			content, err = readTar(reader)
+		}
+	default:
+		return nil, errors.Errorf("content %s is not a directory, zip, or tar", location)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading content bundle %s", location)
+	}
+
+	return getBundleRoot(content)
+}
+
+// readTar repacks a tar in to an in memory zip, which already implements fs.FS
+func readTar(reader io.Reader) (fs.FS, error) {
+	buf := &bytes.Buffer{}
+	writer := zip.NewWriter(buf)
+
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean(header.Name), "./")
+		if name == "." {
+			continue
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			name += "/"
+		}
+
+		file, err := writer.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Store,
+			Modified: header.ModTime,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(file, archive); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+}
+
+// bundleRoot is the directory bundles of a whole content directory are rooted at, e.g. "zip -r content.zip content"
+const bundleRoot = "content"
+
+// getBundleRoot descends in to the bundle's content directory when that's all the bundle holds. Bundles of part of
+// the content, e.g. only posts/ as an overlay, are used as is.
+func getBundleRoot(content fs.FS) (fs.FS, error) {
+	entries, err := fs.ReadDir(content, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 1 && entries[0].IsDir() && entries[0].Name() == bundleRoot {
+		return fs.Sub(content, bundleRoot)
+	}
+
+	return content, nil
+}
+
+// OverlayFS layers several content FSs, files in earlier layers replace files in later layers
+type OverlayFS struct {
+	layers []fs.FS
+}
+
+func NewOverlayFS(layers ...fs.FS) *OverlayFS {
+	return &OverlayFS{
+		layers: layers,
+	}
+}
+
+func (o *OverlayFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	for _, layer := range o.layers {
+		file, err := layer.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		// Directories list the entries of every layer
+		if info.IsDir() {
+			return &overlayDir{File: file, fs: o, name: name}, nil
+		}
+
+		return file, nil
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (o *OverlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries := map[string]fs.DirEntry{}
+	found := false
+
+	for _, layer := range o.layers {
+		layerEntries, err := fs.ReadDir(layer, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		found = true
+		for _, entry := range layerEntries {
+			if _, ok := entries[entry.Name()]; !ok {
+				entries[entry.Name()] = entry
+			}
+		}
+	}
+
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	list := []fs.DirEntry{}
+	for _, entry := range entries {
+		list = append(list, entry)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+
+	return list, nil
+}
+
+// overlayDir is a directory opened from the top most layer with entries merged from all layers
+type overlayDir struct {
+	fs.File
+	fs      *OverlayFS
+	name    string
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *overlayDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fs.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+
+		d.entries = entries
+		d.read = true
+	}
+
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	if count > len(d.entries) {
+		count = len(d.entries)
+	}
+
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+
+	return entries, nil
+}
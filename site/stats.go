@@ -0,0 +1,91 @@
+package site
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const wordsPerMinute = 200
+
+// Stats describe a post's length and structure, they're computed from the rendered body
+type Stats struct {
+	WordCount   int        `json:"word_count"`
+	ReadingTime int        `json:"reading_time"`
+	CodeBlocks  int        `json:"code_blocks"`
+	Outline     []*Heading `json:"outline"`
+}
+
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	Id    string `json:"id,omitempty"`
+}
+
+// getStats counts the words, code blocks, and headings in a post's body, reading time is estimated from the words
+// outside of code blocks as code is skimmed rather than read
+func getStats(body []byte) (*Stats, error) {
+	doc, err := htmlquery.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{Outline: []*Heading{}}
+	countNode(doc, stats)
+
+	stats.ReadingTime = (stats.WordCount + wordsPerMinute - 1) / wordsPerMinute
+	if stats.ReadingTime < 1 {
+		stats.ReadingTime = 1
+	}
+
+	return stats, nil
+}
+
+func countNode(node *html.Node, stats *Stats) {
+	switch {
+	case node.Type == html.TextNode:
+		stats.WordCount += len(strings.Fields(node.Data))
+		return
+	case node.Type != html.ElementNode && node.Type != html.DocumentNode:
+		return
+	case node.DataAtom == atom.Pre:
+		stats.CodeBlocks++
+		return
+	case node.DataAtom == atom.Script || node.DataAtom == atom.Style:
+		return
+	}
+
+	if level := getHeadingLevel(node); level > 0 {
+		stats.Outline = append(stats.Outline, &Heading{
+			Level: level,
+			Text:  strings.TrimSpace(htmlquery.InnerText(node)),
+			Id:    htmlquery.SelectAttr(node, "id"),
+		})
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		countNode(child, stats)
+	}
+}
+
+func getHeadingLevel(node *html.Node) int {
+	switch node.DataAtom {
+	case atom.H1:
+		return 1
+	case atom.H2:
+		return 2
+	case atom.H3:
+		return 3
+	case atom.H4:
+		return 4
+	case atom.H5:
+		return 5
+	case atom.H6:
+		return 6
+	}
+
+	return 0
+}
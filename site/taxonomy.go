@@ -0,0 +1,43 @@
+package site
+
+import (
+	"sort"
+)
+
+// Taxonomy groups posts by the terms (tags, categories) they are filed under
+type Taxonomy struct {
+	Name  string
+	terms map[string][]*Post
+}
+
+func NewTaxonomy(name string) *Taxonomy {
+	return &Taxonomy{
+		Name:  name,
+		terms: map[string][]*Post{},
+	}
+}
+
+// Add files the post under the term, posts should be added newest first
+func (t *Taxonomy) Add(term string, post *Post) {
+	t.terms[term] = append(t.terms[term], post)
+}
+
+func (t *Taxonomy) GetTerms() []string {
+	terms := []string{}
+	for term := range t.terms {
+		terms = append(terms, term)
+	}
+
+	sort.Strings(terms)
+
+	return terms
+}
+
+func (t *Taxonomy) GetPosts(term string) []*Post {
+	return t.terms[term]
+}
+
+// GetKey returns the cache key and path (without leading slash) of a term's listing
+func (t *Taxonomy) GetKey(term string) string {
+	return t.Name + "/" + term
+}
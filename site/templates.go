@@ -2,35 +2,55 @@ package site
 
 import (
 	"fmt"
+	"html/template"
 	"io/fs"
+	"net/url"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"text/template"
+	"github.com/pkg/errors"
 )
 
+// TemplateData is escaped by html/template, fields holding markup we rendered use the trusted types
 type TemplateData struct {
 	Key         string
 	Title       string
-	JavaScript  string
-	CSS         string
-	Content     string
+	JavaScript  template.JS
+	CSS         template.CSS
+	Content     template.HTML
 	Site        *Site
+	Config      *Config
+	Hashes      *Hashes
 	Posts       *[]*Post
 	Generated   time.Time
 	PublishedAt time.Time
+	UpdatedAt   time.Time
+	UpdateNote  string
+	Tags        []string
+	Category    string
 	Social      *Social
 	Pagination  *PaginationData
+	Archive     *ArchiveData
+	Series      *SeriesData
+	Authors     []*Author
+	SiteAuthor  *Author
+	NoIndex     bool
+	Styles      []string
+	Scripts     []string
+	Stats       *Stats
 }
 
 type PaginationData struct {
+	Path        string
 	CurrentPage int
 	TotalPages  int
 	HasNext     bool
 	HasPrev     bool
 	NextPage    int
 	PrevPage    int
+	NextURL     string
+	PrevURL     string
 }
 
 type Social struct {
@@ -40,39 +60,35 @@ type Social struct {
 	Url         string
 }
 
-func LoadTemplates(templateDir string) (*template.Template, error) {
+func LoadTemplates(content fs.FS, templateDir string) (*template.Template, error) {
 	utc, err := time.LoadLocation("UTC")
 	if err != nil {
 		return nil, err
 	}
 
-	tmpl := template.New("").Funcs(template.FuncMap{
+	funcs := map[string]interface{}{
 		"FormatDate": func(date time.Time) string {
 			return date.In(utc).Format(time.RFC3339)
 		},
-		"FormatRssDate": func(date time.Time) string {
-			return date.In(utc).Format(time.RFC1123Z)
-		},
-		"GetAssetURL": func(key string, hashes Hashes) string {
-			return fmt.Sprintf("/static/%s?m=%s", key, hashes[key])
-		},
-	})
+		"GetAssetURL": getAssetURL,
+	}
+
+	tmpl := template.New("").Funcs(funcs)
 
-	err = fs.WalkDir(ContentFS, templateDir, func(path string, d fs.DirEntry, err error) error {
+	err = fs.WalkDir(content, templateDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 		if d.IsDir() || !strings.HasSuffix(path, ".tmpl") {
 			return nil
 		}
-		
-		content, err := fs.ReadFile(ContentFS, path)
+
+		body, err := fs.ReadFile(content, path)
 		if err != nil {
 			return err
 		}
-		
-		name := filepath.Base(path)
-		_, err = tmpl.New(name).Parse(string(content))
+
+		_, err = tmpl.New(filepath.Base(path)).Parse(string(body))
 		return err
 	})
 	if err != nil {
@@ -81,3 +97,37 @@ func LoadTemplates(templateDir string) (*template.Template, error) {
 
 	return tmpl, nil
 }
+
+func getAssetURL(key string, hashes Hashes) string {
+	return fmt.Sprintf("/static/%s?m=%s", key, hashes[key])
+}
+
+// getAssetURLs resolves the stylesheets or scripts named in front matter, names are looked up in the files bundled
+// with a post and then the static assets, paths and URLs are used as is
+func getAssetURLs(names []string, hashes Hashes, base *url.URL, files map[string]*Asset) ([]string, error) {
+	urls := []string{}
+	for _, name := range names {
+		ref, err := url.Parse(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem parsing asset %s", name)
+		}
+
+		if ref.IsAbs() || strings.HasPrefix(name, "/") {
+			urls = append(urls, name)
+			continue
+		}
+
+		if _, ok := files[name]; ok {
+			urls = append(urls, base.ResolveReference(ref).String())
+			continue
+		}
+
+		if _, ok := hashes[name]; !ok {
+			return nil, errors.Errorf("asset %s not found", name)
+		}
+
+		urls = append(urls, getAssetURL(name, hashes))
+	}
+
+	return urls, nil
+}